@@ -1,3 +1,15 @@
 module wget
 
 go 1.22.2
+
+require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/net v0.26.0
+	golang.org/x/term v0.21.0
+)
+
+require (
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
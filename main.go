@@ -15,6 +15,7 @@ func main() {
 			log.Fatal("URL is required for mirroring")
 		}
 		err := utils.MirrorWebsite(url, reject, exclude, convertLinks)
+		finish()
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -29,6 +30,7 @@ func main() {
 		}
 		// Pass rate limit and output directory to concurrent download function
 		err = utils.DownloadFilesConcurrently(urls, output, background, rateLimit, path)
+		finish()
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -40,15 +42,24 @@ func main() {
 		log.Fatal("URL is required for single file download")
 	}
 
-	filename := output
-	if filename == "" {
-		filename = utils.GetFileName(url)
-	}
-
-	// Combine path and filename if path is specified
-	if path != "" {
-		filename = filepath.Join(path, filename)
+	// Without -O, the name is chosen from the URL or the server's response
+	filename := utils.DirTarget(path)
+	if output == "-" {
+		// -O - writes the body to stdout
+		filename = output
+	} else if output != "" {
+		filename = filepath.Join(path, output)
 	}
 
 	utils.DownloadWithLogging(url, filename, background, rateLimit)
+	finish()
+}
+
+// finish prints the -Q and --spider summaries, ending a --spider run with
+// a non-zero status if any URL failed its check.
+func finish() {
+	utils.QuotaSummary()
+	if err := utils.SpiderSummary(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setCredentials sets --user and --password for a test and forgets every
+// trusted origin and challenge afterwards.
+func setCredentials(t *testing.T, user, password string) {
+	oldUser, oldPassword, oldToken := httpUser, httpPassword, bearerToken
+	httpUser, httpPassword = user, password
+	reset := func() {
+		authMu.Lock()
+		trustedOrigins = make(map[string]bool)
+		urlUsers = make(map[string]*url.Userinfo)
+		challenges = make(map[string]*challenge)
+		authMu.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		httpUser, httpPassword, bearerToken = oldUser, oldPassword, oldToken
+		reset()
+	})
+}
+
+func TestParseNetrc(t *testing.T) {
+	data := `# comment
+machine example.com login alice password s3cr#t
+machine other.org
+  login bob
+  password hunter2
+macdef init
+cd /pub
+machine ignored.example login nobody
+
+default login anonymous password guest
+`
+	got := parseNetrc(data)
+	want := []netrcEntry{
+		{machine: "example.com", login: "alice", password: "s3cr#t"},
+		{machine: "other.org", login: "bob", password: "hunter2"},
+		{login: "anonymous", password: "guest"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("parseNetrc = %v, want %v", got, want)
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	got := parseAuthParams(`realm="a, \"quoted\" realm", nonce=abc123, qop="auth,auth-int", stale=FALSE`)
+	want := map[string]string{
+		"realm": `a, "quoted" realm`,
+		"nonce": "abc123",
+		"qop":   "auth,auth-int",
+		"stale": "FALSE",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("parseAuthParams = %v, want %v", got, want)
+	}
+
+	c := parseChallenge([]string{`Basic realm="x"`, `Digest realm="x", nonce="n"`})
+	if c == nil || c.scheme != "digest" {
+		t.Errorf("parseChallenge preferred %v, want digest", c)
+	}
+}
+
+func TestDownloadFileBasicAuth(t *testing.T) {
+	setCredentials(t, "alice", "secret")
+
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization")
+		w.Write([]byte("elsewhere"))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "alice" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, other.URL+"/file", http.StatusFound)
+			return
+		}
+		w.Write([]byte("protected"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := DownloadFile(server.URL+"/file", filepath.Join(dir, "file"), true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "file")); string(got) != "protected" {
+		t.Errorf("saved %q, want the protected body", got)
+	}
+
+	if err := DownloadFile(server.URL+"/away", filepath.Join(dir, "away"), true, 0); err != nil {
+		t.Fatalf("DownloadFile with a redirect failed: %v", err)
+	}
+	if leaked != "" {
+		t.Errorf("credentials were sent to another host: %q", leaked)
+	}
+}
+
+func TestDownloadFileDigestAuth(t *testing.T) {
+	setCredentials(t, "", "")
+
+	const realm, nonce = "test realm", "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+	md5hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, rest, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		p := parseAuthParams(rest)
+		ha1 := md5hex("bob:" + realm + ":pa55")
+		ha2 := md5hex(r.Method + ":" + p["uri"])
+		want := md5hex(strings.Join([]string{ha1, nonce, p["nc"], p["cnonce"], "auth", ha2}, ":"))
+		if scheme != "Digest" || p["username"] != "bob" || p["uri"] != r.URL.RequestURI() || p["response"] != want {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm=%q, nonce=%q, qop="auth", algorithm=MD5`, realm, nonce))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("digest ok"))
+	}))
+	defer server.Close()
+
+	// Credentials in the URL
+	u, _ := url.Parse(server.URL + "/file?x=1")
+	u.User = url.UserPassword("bob", "pa55")
+
+	fileName := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile(u.String(), fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "digest ok" {
+		t.Errorf("saved %q, want the protected body", got)
+	}
+}
+
+func TestBearerTokenOnlyToTrustedHosts(t *testing.T) {
+	setCredentials(t, "", "")
+	bearerToken = "tok"
+
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	// Without trustHost, as for a link found while crawling another site
+	resp, err := httpClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := DownloadFile(server.URL+"/file", filepath.Join(dir, "file"), true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != "" || got[1] != "Bearer tok" {
+		t.Errorf("server saw Authorization %q, want none and then the token", got)
+	}
+}
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Expected digests. --checksum gives one for a single download,
+// --checksum-file names a ".sha256" sidecar or a SHA256SUMS-style list (a
+// local path or a URL), and lines of an -i file may carry their own.
+var (
+	checksumFlag *checksum
+	checksumFile string
+
+	listChecksumsMu sync.Mutex
+	listChecksums   = make(map[string]*checksum)
+
+	sumsOnce sync.Once
+	sums     map[string]*checksum
+	sumsErr  error
+)
+
+// checksum is an expected digest together with the algorithm producing it.
+type checksum struct {
+	algo   string
+	digest []byte
+}
+
+func (c *checksum) String() string {
+	return c.algo + ":" + hex.EncodeToString(c.digest)
+}
+
+// newHash returns a fresh hasher for the checksum's algorithm.
+func (c *checksum) newHash() hash.Hash {
+	switch c.algo {
+	case "sha512":
+		return sha512.New()
+	case "md5":
+		return md5.New()
+	default:
+		return sha256.New()
+	}
+}
+
+// verify compares the digest computed by h against the expected one.
+func (c *checksum) verify(h hash.Hash) error {
+	if got := h.Sum(nil); !bytes.Equal(got, c.digest) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s:%s", c, c.algo, hex.EncodeToString(got))
+	}
+	return nil
+}
+
+// parseChecksum parses "algo:hexdigest", for example "sha256:9f86d0...".
+// Without the "algo:" prefix the algorithm is guessed from the length.
+func parseChecksum(value string) (*checksum, error) {
+	algo, digest, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		algo, digest = "", algo
+	}
+	return newChecksum(strings.ToLower(algo), digest)
+}
+
+// newChecksum validates a hex digest for algo. An empty algo is guessed
+// from the digest length.
+func newChecksum(algo, hexDigest string) (*checksum, error) {
+	digest, err := hex.DecodeString(strings.TrimSpace(hexDigest))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum %q: not hexadecimal", hexDigest)
+	}
+
+	sizes := map[string]int{"md5": md5.Size, "sha256": sha256.Size, "sha512": sha512.Size}
+	if algo == "" {
+		for name, size := range sizes {
+			if size == len(digest) {
+				algo = name
+			}
+		}
+	}
+	size, ok := sizes[algo]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum %q (use sha256, sha512 or md5)", hexDigest)
+	}
+	if len(digest) != size {
+		return nil, fmt.Errorf("invalid %s checksum %q: wrong length", algo, hexDigest)
+	}
+	return &checksum{algo: algo, digest: digest}, nil
+}
+
+// setListChecksum records the digest given for urlStr on its -i line.
+func setListChecksum(urlStr string, c *checksum) {
+	listChecksumsMu.Lock()
+	defer listChecksumsMu.Unlock()
+	listChecksums[urlStr] = c
+}
+
+// expectedChecksum returns the digest that urlStr, saved as fileName, must
+// match, or nil if none was given. A digest from the -i line wins over
+// --checksum, which wins over --checksum-file.
+func expectedChecksum(urlStr, fileName string) (*checksum, error) {
+	listChecksumsMu.Lock()
+	c := listChecksums[urlStr]
+	listChecksumsMu.Unlock()
+	if c != nil {
+		return c, nil
+	}
+	if checksumFlag != nil {
+		return checksumFlag, nil
+	}
+	if checksumFile == "" {
+		return nil, nil
+	}
+
+	sumsOnce.Do(func() {
+		sums, sumsErr = loadSums(checksumFile)
+	})
+	if sumsErr != nil {
+		return nil, fmt.Errorf("reading checksums: %v", sumsErr)
+	}
+	for _, name := range []string{filepath.Base(fileName), GetFileName(urlStr), ""} {
+		if c := sums[name]; c != nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no checksum for %s in %s", filepath.Base(fileName), checksumFile)
+}
+
+// loadSums reads a checksum file from a local path or URL. It understands
+// GNU "digest  name" lines (as written by sha256sum), BSD "SHA256 (name) =
+// digest" lines and a file holding just a digest, which is stored under the
+// empty name. The algorithm is taken from the file name (SHA512SUMS,
+// file.md5, ...) or from the digest length.
+func loadSums(source string) (map[string]*checksum, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := newGetRequest(source)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, newStatusError(resp)
+		}
+		if data, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+
+	algo := ""
+	lowerSource := strings.ToLower(GetFileName(source))
+	for _, name := range []string{"sha512", "sha256", "md5"} {
+		if strings.Contains(lowerSource, name) {
+			algo = name
+			break
+		}
+	}
+
+	result := make(map[string]*checksum)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lineAlgo, name, digest := algo, "", line
+		if tag, rest, ok := strings.Cut(line, " ("); ok && strings.Contains(rest, ") = ") {
+			// BSD style: SHA256 (file.iso) = digest
+			name, digest, _ = strings.Cut(rest, ") = ")
+			lineAlgo = strings.ToLower(strings.ReplaceAll(tag, "-", ""))
+		} else if fields := strings.Fields(line); len(fields) >= 2 {
+			digest = fields[0]
+			name = strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		}
+
+		c, err := newChecksum(lineAlgo, digest)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			name = filepath.Base(name)
+		}
+		result[name] = c
+	}
+	return result, scanner.Err()
+}
+
+// hashFile feeds the first n bytes of the file at path into h; n < 0 means
+// the whole file.
+func hashFile(h hash.Hash, path string, n int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if n >= 0 {
+		r = io.LimitReader(f, n)
+	}
+	_, err = io.Copy(h, r)
+	return err
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetChecksums clears every source of expected digests after a test
+func resetChecksums(t *testing.T) {
+	t.Cleanup(func() {
+		checksumFlag, checksumFile = nil, ""
+		listChecksums = make(map[string]*checksum)
+		sumsOnce, sums, sumsErr = sync.Once{}, nil, nil
+	})
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseChecksum(t *testing.T) {
+	md5Sum := md5.Sum([]byte("x"))
+	tests := []struct {
+		input string
+		algo  string
+		err   bool
+	}{
+		{"sha256:" + sha256Hex([]byte("x")), "sha256", false},
+		{"SHA256:" + sha256Hex([]byte("x")), "sha256", false},
+		{"md5:" + hex.EncodeToString(md5Sum[:]), "md5", false},
+		{sha256Hex([]byte("x")), "sha256", false},
+		{"sha512:" + sha256Hex([]byte("x")), "", true},
+		{"sha256:not-hex", "", true},
+		{"crc32:deadbeef", "", true},
+	}
+
+	for _, tt := range tests {
+		c, err := parseChecksum(tt.input)
+		if (err != nil) != tt.err {
+			t.Errorf("parseChecksum(%q) returned error: %v, expected error: %v", tt.input, err, tt.err)
+			continue
+		}
+		if err == nil && c.algo != tt.algo {
+			t.Errorf("parseChecksum(%q) algo = %q; want %q", tt.input, c.algo, tt.algo)
+		}
+	}
+}
+
+func TestLoadSums(t *testing.T) {
+	a, b, c := sha256Hex([]byte("a")), sha256Hex([]byte("b")), sha256Hex([]byte("c"))
+	path := filepath.Join(t.TempDir(), "SHA256SUMS")
+	content := fmt.Sprintf("# release checksums\n%s  a.tar.gz\n%s *dist/b.zip\nSHA256 (c.iso) = %s\n", a, b, c)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write sums file: %v", err)
+	}
+
+	sums, err := loadSums(path)
+	if err != nil {
+		t.Fatalf("loadSums failed: %v", err)
+	}
+	for name, want := range map[string]string{"a.tar.gz": a, "b.zip": b, "c.iso": c} {
+		if got := sums[name]; got == nil || hex.EncodeToString(got.digest) != want {
+			t.Errorf("sums[%q] = %v; want sha256:%s", name, got, want)
+		}
+	}
+}
+
+func TestDownloadFileChecksum(t *testing.T) {
+	content := []byte("release artifact")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"Matching digest", "sha256:" + sha256Hex(content), false},
+		{"Wrong digest", "sha256:" + sha256Hex([]byte("tampered")), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetChecksums(t)
+			var err error
+			if checksumFlag, err = parseChecksum(tt.checksum); err != nil {
+				t.Fatalf("parseChecksum failed: %v", err)
+			}
+
+			fileName := filepath.Join(t.TempDir(), "artifact.bin")
+			err = DownloadFile(server.URL, fileName, true, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+
+			_, statErr := os.Stat(fileName)
+			_, partErr := os.Stat(partName(fileName))
+			if tt.wantErr && (statErr == nil || partErr == nil) {
+				t.Error("output was kept after a checksum mismatch")
+			}
+			if !tt.wantErr && statErr != nil {
+				t.Errorf("output missing after a matching checksum: %v", statErr)
+			}
+		})
+	}
+}
+
+func TestDownloadFileChecksumResumed(t *testing.T) {
+	resetChecksums(t)
+	content := []byte(strings.Repeat("0123456789", 100))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	continueDownload = true
+	defer func() { continueDownload = false }()
+	checksumFlag, _ = parseChecksum("sha256:" + sha256Hex(content))
+
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(partName(fileName), content[:400], 0644)
+
+	if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+}
+
+func TestChecksumSources(t *testing.T) {
+	good, bad := []byte("good file"), []byte("bad file")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/good.bin", func(w http.ResponseWriter, r *http.Request) { w.Write(good) })
+	mux.HandleFunc("/bad.bin", func(w http.ResponseWriter, r *http.Request) { w.Write(bad) })
+	mux.HandleFunc("/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  good.bin\n%s  bad.bin\n", sha256Hex(good), sha256Hex(good))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("Sums file URL", func(t *testing.T) {
+		resetChecksums(t)
+		checksumFile = server.URL + "/SHA256SUMS"
+		dir := t.TempDir()
+
+		if err := DownloadFile(server.URL+"/good.bin", DirTarget(dir), true, 0); err != nil {
+			t.Errorf("good.bin failed verification: %v", err)
+		}
+		if err := DownloadFile(server.URL+"/bad.bin", DirTarget(dir), true, 0); err == nil {
+			t.Error("bad.bin passed verification")
+		}
+	})
+
+	t.Run("Input file lines", func(t *testing.T) {
+		resetChecksums(t)
+		list := filepath.Join(t.TempDir(), "urls.txt")
+		content := fmt.Sprintf("%s/good.bin sha256:%s\n\n%s/bad.bin sha256:%s\n",
+			server.URL, sha256Hex(good), server.URL, sha256Hex(good))
+		os.WriteFile(list, []byte(content), 0644)
+
+		urls, err := ReadUrlsFromFile(list)
+		if err != nil {
+			t.Fatalf("ReadUrlsFromFile failed: %v", err)
+		}
+		if len(urls) != 2 || urls[0] != server.URL+"/good.bin" {
+			t.Fatalf("ReadUrlsFromFile = %v; want the two URLs without checksums", urls)
+		}
+		if err := DownloadFilesConcurrently(urls, "", true, 0, t.TempDir()); err == nil {
+			t.Error("expected the download of bad.bin to fail verification")
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Network timeouts, set by --connect-timeout, --dns-timeout and
+// --read-timeout, or all at once by --timeout. Zero means no limit.
+var (
+	connectTimeout time.Duration
+	dnsTimeout     time.Duration
+	readTimeout    time.Duration
+)
+
+var (
+	clientMu     sync.Mutex
+	sharedClient *http.Client
+)
+
+// httpClient returns the client used for every request, whether it comes
+// from a single download, an -i list or --mirror. It is built on first use
+// from the current settings.
+func httpClient() *http.Client {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	if sharedClient == nil {
+		sharedClient = newHTTPClient()
+	}
+	return sharedClient
+}
+
+// resetHTTPClient discards the shared client so that the next request
+// picks up changed settings.
+func resetHTTPClient() {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	if sharedClient != nil {
+		sharedClient.CloseIdleConnections()
+	}
+	sharedClient = nil
+}
+
+// newHTTPClient builds the client from the current settings: its
+// transport applies the proxy, TLS, timeout, credential and compression
+// options and prints response headers with -S, its cookie jar is shared
+// by all requests and its redirect policy follows --max-redirect.
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc()
+	// Compression is requested and decoded by compressionTransport
+	transport.DisableCompression = true
+	transport.DialContext = dialContext
+	transport.ResponseHeaderTimeout = readTimeout
+	if connectTimeout > 0 {
+		transport.TLSHandshakeTimeout = connectTimeout
+	}
+
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		// Fail every request rather than connect without the requested TLS setup
+		return &http.Client{Transport: failingTransport{fmt.Errorf("TLS setup: %w", err)}}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	jar, err := newCookieJar()
+	if err != nil {
+		logf("Warning: cookies: %v\n", err)
+	}
+
+	return &http.Client{
+		Transport:     &compressionTransport{base: &idleTimeoutTransport{base: &authTransport{base: &responseLogTransport{base: transport}}}},
+		Jar:           jar,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// dialContext opens a connection with the name lookup and the connect each
+// limited by their own timeout.
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || dnsTimeout <= 0 || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(lookupCtx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try each address in turn, as the standard dialer would
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// idleTimeoutTransport wraps response bodies so that a read that waits
+// longer than --read-timeout for data fails instead of hanging.
+type idleTimeoutTransport struct {
+	base http.RoundTripper
+}
+
+func (t *idleTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || readTimeout <= 0 {
+		return resp, err
+	}
+	resp.Body = newIdleTimeoutBody(resp.Body, readTimeout)
+	return resp, nil
+}
+
+// idleTimeoutBody closes the underlying body when a single Read blocks for
+// longer than timeout. Time the caller spends between reads, for example
+// while rate limiting, does not count.
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.expired.Store(true)
+		body.Close()
+	})
+	b.timer.Stop()
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	b.timer.Stop()
+
+	if b.expired.Load() {
+		return n, errReadTimeout
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
+
+// failingTransport fails every request with err.
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// timeoutError is a net.Error so that retries treat it like any other
+// network timeout.
+type timeoutError struct {
+	msg string
+}
+
+func (e *timeoutError) Error() string   { return e.msg }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+var errReadTimeout error = &timeoutError{msg: "read timed out: no data received within the read timeout"}
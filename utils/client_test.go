@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setReadTimeout swaps in a read timeout and a fresh client for a test
+func setReadTimeout(t *testing.T, timeout time.Duration) {
+	old := readTimeout
+	readTimeout = timeout
+	resetHTTPClient()
+	t.Cleanup(func() {
+		readTimeout = old
+		resetHTTPClient()
+	})
+}
+
+func TestHTTPClientIsShared(t *testing.T) {
+	resetHTTPClient()
+	if httpClient() != httpClient() {
+		t.Error("httpClient returned different clients for the same settings")
+	}
+}
+
+func TestReadTimeoutStalledBody(t *testing.T) {
+	setReadTimeout(t, 50*time.Millisecond)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	resp, err := httpClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if !isRetryable(err) {
+		t.Error("a read timeout should be retryable")
+	}
+}
+
+func TestReadTimeoutIgnoresCallerDelay(t *testing.T) {
+	setReadTimeout(t, 50*time.Millisecond)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("all of the content"))
+	}))
+	defer server.Close()
+
+	resp, err := httpClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Waiting before reading is the caller's business, not a stalled server
+	time.Sleep(100 * time.Millisecond)
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("unexpected error after a slow caller: %v", err)
+	}
+}
+
+func TestDownloadFileReadTimeout(t *testing.T) {
+	setReadTimeout(t, 50*time.Millisecond)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	err := DownloadFile(server.URL, filepath.Join(t.TempDir(), "file.txt"), true, 0)
+	if err == nil {
+		t.Fatal("expected an error from a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("DownloadFile took %v to time out", elapsed)
+	}
+}
+
+func TestDialContextDNSTimeout(t *testing.T) {
+	old := dnsTimeout
+	dnsTimeout = time.Second
+	defer func() { dnsTimeout = old }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	conn, err := dialContext(context.Background(), "tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatalf("dialContext failed: %v", err)
+	}
+	conn.Close()
+}
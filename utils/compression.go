@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression is set by --compression: "none" asks for the plain body,
+// "gzip" for gzip only and "auto" for any encoding we can decode.
+var compression = "none"
+
+// acceptEncoding is the Accept-Encoding header sent for each mode.
+var acceptEncoding = map[string]string{
+	"none": "",
+	"gzip": "gzip",
+	"auto": "gzip, deflate, br, zstd",
+}
+
+// parseCompression checks a --compression value.
+func parseCompression(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if _, ok := acceptEncoding[value]; !ok {
+		return "", fmt.Errorf("invalid compression %q (use auto, gzip or none)", value)
+	}
+	return value, nil
+}
+
+// compressionTransport asks for a compressed body and decodes it, so that
+// callers see the file as it is on the server. Range requests are left
+// alone: their offsets count bytes of the plain file.
+type compressionTransport struct {
+	base http.RoundTripper
+}
+
+func (t *compressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	accept := acceptEncoding[compression]
+	if accept == "" || req.Header.Get("Range") != "" || req.Header.Get("Accept-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set("Accept-Encoding", accept)
+	resp, err := t.base.RoundTrip(r)
+	if err != nil || req.Method == http.MethodHead || resp.Body == http.NoBody ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return resp, err
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "x-gzip" {
+		encoding = "gzip"
+	}
+	if encoding == "" || !slices.Contains(strings.Split(accept, ", "), encoding) {
+		// Identity, or layered or unrequested encodings we leave as they are
+		return resp, nil
+	}
+
+	resp.Body = newDecodedBody(resp.Body, encoding, resp.ContentLength)
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decodedBody is a response body decoded from its Content-Encoding. It
+// counts the bytes that came over the wire, and lets the rate limiter be
+// placed beneath the decoder so that it throttles network traffic rather
+// than the larger decoded stream.
+type decodedBody struct {
+	raw        io.ReadCloser
+	wire       io.Reader // what the decoder reads: raw, possibly rate limited
+	wireRead   atomic.Int64
+	wireLength int64 // Content-Length of the encoded body, or -1
+	encoding   string
+	decoder    io.Reader
+	err        error
+}
+
+func newDecodedBody(raw io.ReadCloser, encoding string, wireLength int64) *decodedBody {
+	return &decodedBody{raw: raw, wire: raw, wireLength: wireLength, encoding: encoding}
+}
+
+// WireBytes returns how many bytes of the encoded body have been read.
+func (b *decodedBody) WireBytes() int64 {
+	return b.wireRead.Load()
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.decoder == nil && b.err == nil {
+		// Created on first use since the decoders read a header straight away
+		b.decoder, b.err = newDecoder(b.encoding, wireCounter{b})
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.decoder.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	if closer, ok := b.decoder.(io.Closer); ok {
+		closer.Close()
+	}
+	return b.raw.Close()
+}
+
+// wireCounter counts what the decoder reads.
+type wireCounter struct {
+	b *decodedBody
+}
+
+func (w wireCounter) Read(p []byte) (int, error) {
+	n, err := w.b.wire.Read(p)
+	w.b.wireRead.Add(int64(n))
+	return n, err
+}
+
+// newDecoder returns a reader decoding r according to encoding.
+func newDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// Meant to be zlib-wrapped, but some servers send raw deflate
+		br := bufio.NewReader(r)
+		header, err := br.Peek(2)
+		if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return brotli.NewReader(r), nil
+	case "zstd":
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// limitBody applies a rate limit to a response body. For a decoded body
+// the limit applies to the bytes read from the network. It must be called
+// before the body is first read.
+func limitBody(body io.Reader, rateLimit int64) (io.Reader, *RateLimitReader) {
+	if decoded, ok := body.(*decodedBody); ok {
+		limiter := NewRateLimitReader(decoded.raw, rateLimit)
+		decoded.wire = limiter
+		return decoded, limiter
+	}
+	limiter := NewRateLimitReader(body, rateLimit)
+	return limiter, limiter
+}
+
+// logCompression reports the encoding and compressed size of a decoded
+// body.
+func logCompression(body io.Reader) {
+	if decoded, ok := body.(*decodedBody); ok {
+		logf("compressed with %s: %d bytes on the wire\n", decoded.encoding, decoded.wireLength)
+	}
+}
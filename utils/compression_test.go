@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// setCompression sets --compression for a test.
+func setCompression(t *testing.T, mode string) {
+	old := compression
+	compression = mode
+	t.Cleanup(func() { compression = old })
+}
+
+// encode compresses data with the named Content-Encoding.
+func encode(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		w, _ = zstd.NewWriter(&buf)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, value := range []string{"auto", "GZIP", " none "} {
+		if _, err := parseCompression(value); err != nil {
+			t.Errorf("parseCompression(%q) failed: %v", value, err)
+		}
+	}
+	if _, err := parseCompression("br"); err == nil {
+		t.Error("parseCompression(br) succeeded, want an error")
+	}
+}
+
+func TestDownloadFileCompression(t *testing.T) {
+	content := []byte(strings.Repeat("a very compressible line of text\n", 500))
+
+	tests := []struct {
+		mode     string
+		encoding string // what the server picks from Accept-Encoding
+		accept   string // the Accept-Encoding it should see
+	}{
+		{"auto", "gzip", "gzip, deflate, br, zstd"},
+		{"auto", "deflate", "gzip, deflate, br, zstd"},
+		{"auto", "raw-deflate", "gzip, deflate, br, zstd"},
+		{"auto", "br", "gzip, deflate, br, zstd"},
+		{"auto", "zstd", "gzip, deflate, br, zstd"},
+		{"gzip", "gzip", "gzip"},
+		{"none", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.encoding, func(t *testing.T) {
+			setCompression(t, tt.mode)
+
+			var accept string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept-Encoding")
+				if tt.encoding == "" {
+					w.Write(content)
+					return
+				}
+				header := tt.encoding
+				if header == "raw-deflate" {
+					header = "deflate"
+				}
+				w.Header().Set("Content-Encoding", header)
+				w.Write(encode(t, tt.encoding, content))
+			}))
+			defer server.Close()
+
+			fileName := filepath.Join(t.TempDir(), "file.txt")
+			// With the progress bar on, so that its output is checked as well
+			if err := DownloadFile(server.URL, fileName, false, 0); err != nil {
+				t.Fatalf("DownloadFile failed: %v", err)
+			}
+			if accept != tt.accept {
+				t.Errorf("Accept-Encoding = %q, want %q", accept, tt.accept)
+			}
+			if got, _ := os.ReadFile(fileName); !bytes.Equal(got, content) {
+				t.Errorf("saved %d bytes, want the %d decoded bytes", len(got), len(content))
+			}
+		})
+	}
+}
+
+func TestCompressionSkipsRanges(t *testing.T) {
+	setCompression(t, "auto")
+	continueDownload = true
+	defer func() { continueDownload = false }()
+
+	content := []byte(strings.Repeat("0123456789", 100))
+	var accept []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = append(accept, r.Header.Get("Accept-Encoding"))
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(partName(fileName), content[:300], 0644)
+	if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if len(accept) != 1 || accept[0] != "" {
+		t.Errorf("range request sent Accept-Encoding %q, want none", accept)
+	}
+	if got, _ := os.ReadFile(fileName); !bytes.Equal(got, content) {
+		t.Errorf("resumed file has %d bytes, want %d matching bytes", len(got), len(content))
+	}
+}
+
+func TestLimitBodyThrottlesWire(t *testing.T) {
+	content := []byte(strings.Repeat("x", 100000))
+	compressed := encode(t, "gzip", content)
+	body := newDecodedBody(io.NopCloser(bytes.NewReader(compressed)), "gzip", int64(len(compressed)))
+
+	// The compressed body is tiny, so a limit on the wire barely slows it
+	// down, while a limit on the decoded bytes would take ten seconds
+	reader, limiter := limitBody(body, 10000)
+	if limiter == nil {
+		t.Fatal("limitBody returned no limiter")
+	}
+	start := time.Now()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading failed: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("read %d bytes, want %d", len(got), len(content))
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("reading took %v; the limit was applied to decoded bytes", elapsed)
+	}
+	if body.WireBytes() != int64(len(compressed)) {
+		t.Errorf("counted %d wire bytes, want %d", body.WireBytes(), len(compressed))
+	}
+}
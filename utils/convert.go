@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// savedFile is a file the mirror wrote.
+type savedFile struct {
+	url  string // what it was fetched from
+	path string // slash-separated, relative to the mirror's folder
+	kind string // "html" and "css" files have their links converted
+}
+
+// The files of the current mirror, by normalized URL. Links are converted
+// once the crawl is over, when it is known which URLs were saved.
+var (
+	savedMu    sync.Mutex
+	savedFiles map[string]*savedFile
+)
+
+// resetSavedFiles starts the record of a new mirror.
+func resetSavedFiles() {
+	savedMu.Lock()
+	defer savedMu.Unlock()
+	savedFiles = make(map[string]*savedFile)
+}
+
+// recordSaved notes that urlStr was saved at relativePath.
+func recordSaved(urlStr, relativePath, kind string) {
+	savedMu.Lock()
+	defer savedMu.Unlock()
+	if savedFiles != nil {
+		savedFiles[normalizeURL(urlStr)] = &savedFile{url: urlStr, path: filepath.ToSlash(relativePath), kind: kind}
+	}
+}
+
+// lookupSaved returns the saved file for urlStr, if there is one.
+func lookupSaved(urlStr string) (*savedFile, bool) {
+	savedMu.Lock()
+	defer savedMu.Unlock()
+	f, ok := savedFiles[normalizeURL(urlStr)]
+	return f, ok
+}
+
+// convertSavedFiles rewrites the links in every HTML page and stylesheet
+// the mirror saved under baseFolder. Links to saved files become paths
+// relative to the file they are in. With convertLinks the others become
+// absolute URLs; without it only links to stylesheets and scripts are
+// touched.
+func convertSavedFiles(baseFolder string, convertLinks bool) {
+	savedMu.Lock()
+	files := make(map[string]*savedFile)
+	for _, f := range savedFiles {
+		if f.kind != "" {
+			// A redirect records one file under two URLs
+			files[f.path] = f
+		}
+	}
+	savedMu.Unlock()
+
+	for _, f := range files {
+		fullPath := filepath.Join(baseFolder, filepath.FromSlash(f.path))
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			logf("Error converting links in %s: %v\n", fullPath, err)
+			continue
+		}
+
+		rewrite := linkConverter(f.path, convertLinks)
+		var converted string
+		if f.kind == "html" {
+			converted = convertHTML(string(content), f.url, rewrite)
+		} else {
+			converted = rewriteCSS(string(content), func(raw string) string { return rewrite(f.url, raw) })
+		}
+		if converted == string(content) {
+			continue
+		}
+		logf("Converting links in %s\n", fullPath)
+		if err := os.WriteFile(fullPath, []byte(converted), 0644); err != nil {
+			logf("Error converting links in %s: %v\n", fullPath, err)
+		}
+	}
+}
+
+// linkConverter returns the function that rewrites a link, found in the
+// file saved at fromPath and resolved against base. It returns raw when
+// the link is to be left alone.
+func linkConverter(fromPath string, convertLinks bool) func(base, raw string) string {
+	return func(base, raw string) string {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			return raw
+		}
+		absolute := resolveURL(base, raw)
+		if !isWebURL(absolute) {
+			return raw
+		}
+
+		target, ok := lookupSaved(absolute)
+		if !ok {
+			if convertLinks {
+				return absolute
+			}
+			return raw
+		}
+		if !convertLinks && target.kind != "css" && path.Ext(target.path) != ".js" {
+			return raw
+		}
+
+		rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(fromPath)), filepath.FromSlash(target.path))
+		if err != nil {
+			return raw
+		}
+		local := &url.URL{Path: filepath.ToSlash(rel)}
+		if u, err := url.Parse(absolute); err == nil {
+			local.Fragment = u.Fragment
+		}
+		return local.String()
+	}
+}
+
+// convertHTML rewrites the links of an HTML page served from pageURL.
+// Only tags with a changed URL are rewritten; the rest of the document is
+// copied as it was. A <base> tag is dropped, since the converted links are
+// relative to the page itself; the relative links left alone are made
+// absolute so that they still lead where the <base> sent them.
+func convertHTML(content, pageURL string, rewrite func(base, raw string) string) string {
+	base := documentBase(content, pageURL)
+	link := func(raw string) string {
+		v := rewrite(base, raw)
+		if base == pageURL || v != strings.TrimSpace(raw) || v == "" {
+			return v
+		}
+		if u, err := url.Parse(v); err == nil && !u.IsAbs() {
+			if absolute := resolveURL(base, v); absolute != "" {
+				return absolute
+			}
+		}
+		return v
+	}
+
+	var out bytes.Buffer
+	inStyle := false
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		// Copied, as z.Token unescapes attribute values in the same buffer
+		raw := append([]byte(nil), z.Raw()...)
+		switch tt {
+		case html.TextToken:
+			if inStyle {
+				out.WriteString(rewriteCSS(string(raw), link))
+				continue
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "style" {
+				inStyle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.Data == "base" {
+				continue
+			}
+			if tok.Data == "style" {
+				inStyle = tt == html.StartTagToken
+			}
+
+			changed := false
+			for _, attr := range tagURLAttrs(tok) {
+				for i, a := range tok.Attr {
+					if a.Namespace != "" || a.Key != attr.key {
+						continue
+					}
+					if v := rewriteAttr(attr.form, a.Val, link); v != a.Val {
+						tok.Attr[i].Val = v
+						changed = true
+					}
+				}
+			}
+			if changed {
+				out.WriteString(tok.String())
+				continue
+			}
+		}
+		out.Write(raw)
+	}
+	return out.String()
+}
+
+// rewriteAttr applies rewrite to each URL in an attribute value of the
+// given form.
+func rewriteAttr(form int, value string, rewrite func(string) string) string {
+	switch form {
+	case srcsetURLs:
+		changed := false
+		candidates := strings.Split(value, ",")
+		for i, candidate := range candidates {
+			if fields := strings.Fields(candidate); len(fields) > 0 {
+				if u := rewrite(fields[0]); u != fields[0] {
+					fields[0], changed = u, true
+				}
+				candidates[i] = strings.Join(fields, " ")
+			}
+		}
+		if !changed {
+			return value
+		}
+		return strings.Join(candidates, ", ")
+	case refreshURLs:
+		target := refreshURL(value)
+		if target == "" {
+			return value
+		}
+		i := strings.LastIndex(value, target)
+		return value[:i] + rewrite(target) + value[i+len(target):]
+	case cssURLs:
+		return rewriteCSS(value, rewrite)
+	}
+	if v := rewrite(value); v != strings.TrimSpace(value) {
+		return v
+	}
+	return value
+}
+
+// rewriteCSS applies rewrite to each url() and @import reference in css.
+func rewriteCSS(css string, rewrite func(string) string) string {
+	for _, pattern := range cssURLPatterns {
+		css = pattern.ReplaceAllStringFunc(css, func(match string) string {
+			loc := pattern.FindStringSubmatchIndex(match)
+			return match[:loc[2]] + rewrite(match[loc[2]:loc[3]]) + match[loc[3]:]
+		})
+	}
+	return css
+}
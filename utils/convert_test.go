@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setSavedFiles records a mirror's saved files for a test.
+func setSavedFiles(t *testing.T, files ...savedFile) {
+	resetSavedFiles()
+	for _, f := range files {
+		recordSaved(f.url, f.path, f.kind)
+	}
+	t.Cleanup(func() {
+		savedMu.Lock()
+		savedFiles = nil
+		savedMu.Unlock()
+	})
+}
+
+const convertPage = `<html><head>
+<base href="/docs/">
+<link rel=stylesheet href='/css/site.css'>
+<script src="/js/app.js"></script>
+<style>body { background: url(/img/a.png) }</style>
+</head><body>
+<p>Text that says src="/img/a.png" is left alone.</p>
+<img src=/img/a.png srcset="/img/a.png 1x, /img/missing.png 2x">
+<a href="page.html#intro">next</a>
+<a href="/other.html">not mirrored</a>
+<a href="#top">top</a>
+</body></html>`
+
+func TestConvertHTML(t *testing.T) {
+	setSavedFiles(t,
+		savedFile{url: "http://example.com/css/site.css", path: "css/site.css", kind: "css"},
+		savedFile{url: "http://example.com/js/app.js", path: "js/app.js"},
+		savedFile{url: "http://example.com/img/a.png", path: "img/a.png"},
+		savedFile{url: "http://example.com/docs/page.html", path: "docs/page.html", kind: "html"},
+	)
+
+	got := convertHTML(convertPage, "http://example.com/docs/", linkConverter("docs/index.html", true))
+	for _, want := range []string{
+		`<link rel="stylesheet" href="../css/site.css">`,
+		`<script src="../js/app.js">`,
+		`background: url(../img/a.png)`,
+		`<p>Text that says src="/img/a.png" is left alone.</p>`,
+		`<img src="../img/a.png" srcset="../img/a.png 1x, http://example.com/img/missing.png 2x">`,
+		`<a href="page.html#intro">`,
+		`<a href="http://example.com/other.html">`,
+		`<a href="#top">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("converted page lacks %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<base") {
+		t.Errorf("converted page kept its <base>:\n%s", got)
+	}
+
+	// Without --convert-links only stylesheets and scripts are made local
+	got = convertHTML(convertPage, "http://example.com/docs/", linkConverter("docs/index.html", false))
+	for _, want := range []string{
+		`href="../css/site.css"`,
+		`<script src="../js/app.js">`,
+		`<img src=/img/a.png srcset="/img/a.png 1x, /img/missing.png 2x">`,
+		`<a href="/other.html">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("page lacks %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestConvertHTMLKeepsUntouchedTags(t *testing.T) {
+	setSavedFiles(t, savedFile{url: "http://example.com/img/a.png", path: "img/a.png"})
+
+	page := `<a href="x?a=1&amp;b=2" title="a &amp; b">x</a><img alt="&lt;logo&gt;" src="/img/a.png">`
+	got := convertHTML(page, "http://example.com/", linkConverter("index.html", false))
+	if want := `<a href="x?a=1&amp;b=2" title="a &amp; b">x</a>`; !strings.HasPrefix(got, want) {
+		t.Errorf("untouched tag was changed: %s", got)
+	}
+	got = convertHTML(page, "http://example.com/", linkConverter("index.html", true))
+	for _, want := range []string{`href="http://example.com/x?a=1&amp;b=2"`, `title="a &amp; b"`, `<img alt="&lt;logo&gt;" src="img/a.png">`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("converted page lacks %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestConvertHTMLBaseWithoutConvertLinks(t *testing.T) {
+	setSavedFiles(t, savedFile{url: "http://h/docs/site.css", path: "docs/site.css", kind: "css"})
+
+	page := `<base href="http://h/docs/"><link rel="stylesheet" href="site.css"><a href="guide.html">g</a><a href="#top">top</a>`
+	got := convertHTML(page, "http://h/index.html", linkConverter("index.html", false))
+	for _, want := range []string{`href="docs/site.css"`, `<a href="http://h/docs/guide.html">`, `<a href="http://h/docs/#top">`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("page lacks %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<base") {
+		t.Errorf("page kept its <base>:\n%s", got)
+	}
+}
+
+func TestMirrorWebsiteConvertLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/guide/intro.html">intro</a> <a href="http://elsewhere.invalid/x">x</a>`))
+		case "/guide/intro.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<link rel="stylesheet" href="/assets/site.css"><a href="/">home</a>`))
+		case "/assets/site.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`body { background: url("/img/bg.png") }`))
+		case "/img/bg.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := inTempDir(t)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, true); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+
+	u, _ := url.Parse(server.URL)
+	root := filepath.Join(dir, u.Host)
+	for file, want := range map[string]string{
+		"index.html":       `<a href="guide/intro.html">`,
+		"guide/intro.html": `<link rel="stylesheet" href="../assets/site.css"><a href="../index.html">`,
+		"assets/site.css":  `url("../img/bg.png")`,
+	} {
+		data, err := os.ReadFile(filepath.Join(root, file))
+		if err != nil {
+			t.Errorf("%s was not saved: %v", file, err)
+			continue
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s = %s, want it to contain %s", file, data, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Cookie settings, set by --load-cookies, --save-cookies and
+// --keep-session-cookies. Files use the Netscape cookies.txt format.
+var (
+	loadCookiesFile    string
+	saveCookiesFile    string
+	keepSessionCookies bool
+)
+
+// cookieJar is the http.CookieJar shared by every request. Unlike
+// net/http/cookiejar it keeps each cookie's domain, path and expiry, which
+// are needed to write cookies.txt. When saveFile is set, the file is
+// rewritten whenever the jar changes, so it is current however the program
+// ends.
+type cookieJar struct {
+	mu       sync.Mutex
+	entries  map[string]*jarEntry // keyed by domain, path and name
+	saveFile string
+}
+
+// jarEntry is a stored cookie.
+type jarEntry struct {
+	name, value  string
+	domain, path string
+	hostOnly     bool // sent to domain only, not its subdomains
+	secure       bool
+	httpOnly     bool
+	expires      time.Time // zero for a session cookie
+}
+
+func (e *jarEntry) key() string {
+	return e.domain + ";" + e.path + ";" + e.name
+}
+
+func (e *jarEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !e.expires.After(now)
+}
+
+// newCookieJar returns a jar holding the cookies from --load-cookies.
+func newCookieJar() (*cookieJar, error) {
+	jar := &cookieJar{entries: make(map[string]*jarEntry)}
+	if loadCookiesFile != "" {
+		if err := jar.load(loadCookiesFile); err != nil {
+			return jar, err
+		}
+	}
+	jar.saveFile = saveCookiesFile
+	return jar, jar.save()
+}
+
+// SetCookies stores the cookies a response from u asked to set, following
+// the domain and path rules of RFC 6265.
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u.Host)
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, c := range cookies {
+		e := &jarEntry{name: c.Name, value: c.Value, secure: c.Secure, httpOnly: c.HttpOnly}
+
+		e.domain, e.hostOnly = host, true
+		if c.Domain != "" {
+			domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+			if !domainMatch(host, domain) || !strings.Contains(domain, ".") && domain != host {
+				continue
+			}
+			if ps, _ := publicsuffix.PublicSuffix(domain); ps == domain {
+				// co.uk and the like may not be given cookies, other than
+				// by a server on exactly that name, which then keeps them
+				if domain != host {
+					continue
+				}
+			} else {
+				e.domain, e.hostOnly = domain, false
+			}
+		}
+
+		e.path = c.Path
+		if !strings.HasPrefix(e.path, "/") {
+			e.path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			e.expires = now
+		case c.MaxAge > 0:
+			e.expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			e.expires = c.Expires
+		}
+
+		if e.expired(now) {
+			delete(j.entries, e.key())
+		} else {
+			j.entries[e.key()] = e
+		}
+	}
+
+	if err := j.save(); err != nil {
+		logf("Warning: could not save cookies: %v\n", err)
+	}
+}
+
+// Cookies returns the cookies to send with a request to u, longest path
+// first.
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u.Host)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	now := time.Now()
+
+	j.mu.Lock()
+	var matches []*jarEntry
+	for _, e := range j.entries {
+		if e.expired(now) || e.secure && u.Scheme != "https" {
+			continue
+		}
+		if e.hostOnly && host != e.domain || !e.hostOnly && !domainMatch(host, e.domain) {
+			continue
+		}
+		if !pathMatch(path, e.path) {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	j.mu.Unlock()
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		return len(matches[a].path) > len(matches[b].path)
+	})
+	cookies := make([]*http.Cookie, len(matches))
+	for i, e := range matches {
+		cookies[i] = &http.Cookie{Name: e.name, Value: e.value}
+	}
+	return cookies
+}
+
+// load adds the cookies in a cookies.txt file to the jar. Lines starting
+// with "#HttpOnly_" are cookies too; other comments are skipped.
+func (j *cookieJar) load(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("%s:%d: want 7 tab-separated fields, got %d", fileName, lineNo, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid expiry %q", fileName, lineNo, fields[4])
+		}
+
+		e := &jarEntry{
+			domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			hostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			path:     fields[2],
+			secure:   strings.EqualFold(fields[3], "TRUE"),
+			httpOnly: httpOnly,
+			name:     fields[5],
+			value:    fields[6],
+		}
+		if expires > 0 {
+			e.expires = time.Unix(expires, 0)
+		}
+		if !e.expired(now) {
+			j.entries[e.key()] = e
+		}
+	}
+	return scanner.Err()
+}
+
+// save writes the jar to saveFile, if set. Session cookies are left out
+// unless --keep-session-cookies is given. The caller holds j.mu or owns j.
+func (j *cookieJar) save() error {
+	if j.saveFile == "" {
+		return nil
+	}
+
+	entries := make([]*jarEntry, 0, len(j.entries))
+	now := time.Now()
+	for _, e := range j.entries {
+		if e.expired(now) || e.expires.IsZero() && !keepSessionCookies {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].key() < entries[b].key() })
+
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n# Generated by wget. Edit at your own risk.\n\n")
+	for _, e := range entries {
+		domain, subdomains := e.domain, "FALSE"
+		if !e.hostOnly {
+			domain, subdomains = "."+e.domain, "TRUE"
+		}
+		if e.httpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expires int64
+		if !e.expires.IsZero() {
+			expires = e.expires.Unix()
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, subdomains, e.path, strings.ToUpper(strconv.FormatBool(e.secure)), expires, e.name, e.value)
+	}
+
+	// Replace the file in one step so a reader never sees half of it
+	tmp, err := os.CreateTemp(filepath.Dir(j.saveFile), ".cookies-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), j.saveFile)
+}
+
+// canonicalHost strips the port from a URL host and lower-cases it.
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// domainMatch reports whether host is domain or one of its subdomains. IP
+// addresses only match themselves.
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch reports whether a request for path may carry a cookie set for
+// cookiePath.
+func pathMatch(path, cookiePath string) bool {
+	if path == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/'
+}
+
+// defaultCookiePath is the path a cookie without a Path attribute applies
+// to: the directory of the request path.
+func defaultCookiePath(urlPath string) string {
+	i := strings.LastIndex(urlPath, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return urlPath[:i]
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setCookieFiles points the cookie settings at files for the duration of a
+// test and gives it a fresh client and jar.
+func setCookieFiles(t *testing.T, load, save string, keepSession bool) {
+	oldLoad, oldSave, oldKeep := loadCookiesFile, saveCookiesFile, keepSessionCookies
+	loadCookiesFile, saveCookiesFile, keepSessionCookies = load, save, keepSession
+	resetHTTPClient()
+	t.Cleanup(func() {
+		loadCookiesFile, saveCookiesFile, keepSessionCookies = oldLoad, oldSave, oldKeep
+		resetHTTPClient()
+	})
+}
+
+func cookieNames(cookies []*http.Cookie) string {
+	var names []string
+	for _, c := range cookies {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCookieJarRules(t *testing.T) {
+	setCookieFiles(t, "", "", false)
+	jar, err := newCookieJar()
+	if err != nil {
+		t.Fatalf("newCookieJar failed: %v", err)
+	}
+
+	origin, _ := url.Parse("https://www.example.com/app/login")
+	jar.SetCookies(origin, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "secure", Value: "3", Path: "/", Secure: true},
+		{Name: "foreign", Value: "4", Domain: "other.com"},
+		{Name: "tld", Value: "5", Domain: "com"},
+		{Name: "gone", Value: "6", MaxAge: -1},
+	})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.example.com/app/page", "domain,host,secure"},
+		{"http://www.example.com/app/page", "domain,host"},
+		{"https://www.example.com/other", "domain,secure"},
+		{"https://api.example.com/app/page", "domain"},
+		{"https://other.com/", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		got := jar.Cookies(u)
+		// Order within the same path length is not defined
+		names := strings.Split(cookieNames(got), ",")
+		if len(got) == 0 {
+			names = nil
+		}
+		want := strings.Split(tt.want, ",")
+		if tt.want == "" {
+			want = nil
+		}
+		if !sameSet(names, want) {
+			t.Errorf("Cookies(%s) = %q, want %q", tt.url, names, want)
+		}
+	}
+}
+
+func TestCookieJarPublicSuffix(t *testing.T) {
+	setCookieFiles(t, "", "", false)
+	jar, err := newCookieJar()
+	if err != nil {
+		t.Fatalf("newCookieJar failed: %v", err)
+	}
+
+	evil, _ := url.Parse("https://evil.co.uk/")
+	jar.SetCookies(evil, []*http.Cookie{
+		{Name: "suffix", Value: "1", Domain: ".co.uk"},
+		{Name: "own", Value: "2", Domain: "evil.co.uk"},
+	})
+	victim, _ := url.Parse("https://bank.co.uk/")
+	if got := jar.Cookies(victim); len(got) != 0 {
+		t.Errorf("bank.co.uk got cookies %s set for a public suffix", cookieNames(got))
+	}
+	if got := cookieNames(jar.Cookies(evil)); got != "own" {
+		t.Errorf("evil.co.uk got %q, want own", got)
+	}
+
+	// A host that is itself a suffix keeps the cookie for itself alone
+	suffixHost, _ := url.Parse("https://github.io/")
+	jar.SetCookies(suffixHost, []*http.Cookie{{Name: "self", Value: "3", Domain: "github.io"}})
+	if got := cookieNames(jar.Cookies(suffixHost)); got != "self" {
+		t.Errorf("github.io got %q, want self", got)
+	}
+	sub, _ := url.Parse("https://someone.github.io/")
+	if got := jar.Cookies(sub); len(got) != 0 {
+		t.Errorf("someone.github.io got %s", cookieNames(got))
+	}
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, s := range a {
+		seen[s] = true
+	}
+	for _, s := range b {
+		if !seen[s] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCookieFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	expires := time.Now().Add(time.Hour).Unix()
+	input := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tFALSE\t" + strconv.FormatInt(expires, 10) + "\tsid\tabc\n" +
+		"#HttpOnly_www.example.com\tFALSE\t/app\tTRUE\t" + strconv.FormatInt(expires, 10) + "\ttoken\txyz\n" +
+		"example.com\tFALSE\t/\tFALSE\t0\tsession\ts\n" +
+		"example.com\tFALSE\t/\tFALSE\t1\texpired\tx\n"
+	load := filepath.Join(dir, "in.txt")
+	os.WriteFile(load, []byte(input), 0644)
+
+	save := filepath.Join(dir, "out.txt")
+	setCookieFiles(t, load, save, false)
+	jar, err := newCookieJar()
+	if err != nil {
+		t.Fatalf("newCookieJar failed: %v", err)
+	}
+
+	u, _ := url.Parse("https://www.example.com/app/x")
+	if got := cookieNames(jar.Cookies(u)); got != "token,sid" {
+		t.Errorf("loaded cookies for %s = %q, want token,sid", u, got)
+	}
+
+	saved, _ := os.ReadFile(save)
+	for _, want := range []string{
+		".example.com\tTRUE\t/\tFALSE\t" + strconv.FormatInt(expires, 10) + "\tsid\tabc\n",
+		"#HttpOnly_www.example.com\tFALSE\t/app\tTRUE\t" + strconv.FormatInt(expires, 10) + "\ttoken\txyz\n",
+	} {
+		if !strings.Contains(string(saved), want) {
+			t.Errorf("saved file lacks %q:\n%s", want, saved)
+		}
+	}
+	if strings.Contains(string(saved), "session") || strings.Contains(string(saved), "expired") {
+		t.Errorf("saved file has session or expired cookies:\n%s", saved)
+	}
+
+	keepSessionCookies = true
+	jar.save()
+	if saved, _ := os.ReadFile(save); !strings.Contains(string(saved), "\tsession\ts\n") {
+		t.Errorf("--keep-session-cookies did not save the session cookie:\n%s", saved)
+	}
+}
+
+func TestDownloadFileSharesCookies(t *testing.T) {
+	save := filepath.Join(t.TempDir(), "cookies.txt")
+	setCookieFiles(t, "", save, true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "secret", Path: "/"})
+			w.Write([]byte("logged in"))
+			return
+		}
+		if c, err := r.Cookie("sid"); err != nil || c.Value != "secret" {
+			http.Error(w, "login first", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("private"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := DownloadFile(server.URL+"/login", filepath.Join(dir, "login"), true, 0); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if err := DownloadFile(server.URL+"/private", filepath.Join(dir, "private"), true, 0); err != nil {
+		t.Fatalf("the session cookie was not sent: %v", err)
+	}
+	if saved, _ := os.ReadFile(save); !strings.Contains(string(saved), "\tsid\tsecret\n") {
+		t.Errorf("cookies.txt lacks the session cookie:\n%s", saved)
+	}
+}
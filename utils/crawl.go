@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Recursion settings, set by -r/--recursive and -l/--level. A level of 0
+// or less means no depth limit; CheckFlags gives -r its default of 5.
+var (
+	recursive  bool
+	crawlLevel = -1
+)
+
+// The images, stylesheets and other files the current crawl has fetched,
+// by normalized URL, so that those shared by many pages are fetched once.
+// It is nil outside a crawl.
+var (
+	requisitesMu   sync.Mutex
+	requisitesSeen map[string]bool
+)
+
+// errAlreadyFetched is returned for a file the crawl has already fetched.
+var errAlreadyFetched = errors.New("already fetched")
+
+// crawlItem is a page waiting in the crawl frontier.
+type crawlItem struct {
+	url   string
+	depth int // links followed from the start page
+}
+
+// crawl mirrors startURL and, breadth first, every same-host page linked
+// from it down to -l levels. Each page is fetched once however many links
+// lead to it. Only a failure of the start page ends the crawl early.
+func crawl(startURL, baseFolder string, reject []string, exclude []string) error {
+	start := normalizeURL(startURL)
+	queue := []crawlItem{{url: start}}
+	seen := map[string]bool{start: true}
+
+	requisitesMu.Lock()
+	requisitesSeen = make(map[string]bool)
+	requisitesMu.Unlock()
+	defer func() {
+		requisitesMu.Lock()
+		requisitesSeen = nil
+		requisitesMu.Unlock()
+	}()
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+
+		links, err := downloadPage(item.url, start, baseFolder, reject, exclude)
+		if errors.Is(err, errQuotaExceeded) {
+			break
+		}
+		if err != nil {
+			if item.depth == 0 {
+				return err
+			}
+			logf("Error downloading page %s: %v\n", item.url, err)
+			continue
+		}
+
+		if crawlLevel > 0 && item.depth >= crawlLevel {
+			continue
+		}
+		for _, link := range links {
+			if !seen[link] {
+				seen[link] = true
+				queue = append(queue, crawlItem{url: link, depth: item.depth + 1})
+			}
+		}
+	}
+	return nil
+}
+
+// claimRequisite reports whether urlStr is yet to be fetched by the
+// current crawl, marking it as fetched. Outside a crawl it always is.
+func claimRequisite(urlStr string) bool {
+	requisitesMu.Lock()
+	defer requisitesMu.Unlock()
+	if requisitesSeen == nil {
+		return true
+	}
+	key := normalizeURL(urlStr)
+	if requisitesSeen[key] {
+		return false
+	}
+	requisitesSeen[key] = true
+	return true
+}
+
+// pageLinks returns the normalized URLs of the pages on siteURL's host that
+// htmlContent, served from pageURL, links to, skipping those the -R and -X
+// filters reject and, unless robots are off, rel="nofollow" links and
+// pages robots.txt disallows.
+func pageLinks(htmlContent, pageURL, siteURL string, reject []string, exclude []string) []string {
+	var links []string
+	for _, link := range extractLinks(htmlContent, pageURL) {
+		if !link.page || !isSameDomain(siteURL, link.absolute) || !shouldDownloadFile(link.absolute, reject, exclude) {
+			continue
+		}
+		if robotsEnabled && link.nofollow {
+			continue
+		}
+		if !robotsAllowed(link.absolute) {
+			logf("Skipping %s: disallowed by robots.txt\n", link.absolute)
+			continue
+		}
+		links = append(links, normalizeURL(link.absolute))
+	}
+	return links
+}
+
+// normalizeURL puts urlStr in the form the crawler compares URLs in: the
+// fragment dropped, scheme and host in lower case, no default port, and an
+// empty path written as "/".
+func normalizeURL(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+	u.Fragment, u.RawFragment = "", ""
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); port == "80" && u.Scheme == "http" || port == "443" && u.Scheme == "https" {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// parseLevel reads an -l value: a number of levels, or "inf" (or 0) for
+// no limit.
+func parseLevel(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "inf") {
+		return 0, nil
+	}
+	level, err := strconv.Atoi(value)
+	if err != nil || level < 0 {
+		return 0, fmt.Errorf("invalid level %q (use a number or inf)", value)
+	}
+	return level, nil
+}
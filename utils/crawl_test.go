@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// setCrawlLevel sets -l for a test.
+func setCrawlLevel(t *testing.T, level int) {
+	old := crawlLevel
+	crawlLevel = level
+	t.Cleanup(func() { crawlLevel = old })
+}
+
+// inTempDir runs the rest of a test in a fresh working directory.
+func inTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := map[string]string{
+		"http://Example.COM":             "http://example.com/",
+		"http://example.com:80/a#top":    "http://example.com/a",
+		"https://example.com:443/a?q=1":  "https://example.com/a?q=1",
+		"http://example.com:8080/a/../b": "http://example.com:8080/a/../b",
+	}
+	for input, want := range tests {
+		if got := normalizeURL(input); got != want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for input, want := range map[string]int{"3": 3, "0": 0, "inf": 0, "INF": 0} {
+		if got, err := parseLevel(input); err != nil || got != want {
+			t.Errorf("parseLevel(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "-1", "deep"} {
+		if _, err := parseLevel(bad); err == nil {
+			t.Errorf("parseLevel(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestMirrorWebsiteCrawlsBreadthFirst(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	pages := map[string]string{
+		"/":           `<a href="/a.html">a</a> <a href="/files/data.bin">data</a> <a href="http://elsewhere.invalid/">out</a>`,
+		"/a.html":     `<a href="/#top">home</a> <a href="b/">b</a>`,
+		"/b/":         `<img src="logo.png"> <a href="/">home</a> <a href="c.html">c</a>`,
+		"/b/c.html":   `<p>too deep</p>`,
+		"/b/logo.png": "png",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/files/data.bin" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("binary"))
+			return
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if filepath.Ext(r.URL.Path) == ".png" {
+			w.Header().Set("Content-Type", "image/png")
+		} else {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	dir := inTempDir(t)
+	setCrawlLevel(t, 2)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+
+	u, _ := url.Parse(server.URL)
+	root := filepath.Join(dir, u.Host)
+	for _, want := range []string{"index.html", "a.html", "files/data.bin", "b/index.html", "b/logo.png"} {
+		if _, err := os.Stat(filepath.Join(root, want)); err != nil {
+			t.Errorf("%s was not saved: %v", want, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "b/c.html")); err == nil {
+		t.Error("b/c.html was saved beyond -l 2")
+	}
+	if hits["/"] != 1 {
+		t.Errorf("the start page was fetched %d times, want once", hits["/"])
+	}
+}
+
+func TestMirrorWebsiteStaysOnHost(t *testing.T) {
+	var mu sync.Mutex
+	foreign := make(map[string]bool)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		foreign[r.URL.Path] = true
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/secret.html">secret</a>`))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/away">away</a>`))
+		case "/away":
+			http.Redirect(w, r, other.URL+"/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := inTempDir(t)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if foreign["/secret.html"] {
+		t.Error("the crawl followed links on the host a page redirected to")
+	}
+	u, _ := url.Parse(server.URL)
+	if _, err := os.Stat(filepath.Join(dir, u.Host, "away", "index.html")); !os.IsNotExist(err) {
+		t.Errorf("the other host's page was saved: %v", err)
+	}
+}
+
+func TestMirrorWebsiteFetchesSharedFilesOnce(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/", "/a.html", "/b.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<link rel="stylesheet" href="/site.css"><img src="/logo.png"><a href="/a.html">a</a><a href="/b.html">b</a>`))
+		case "/site.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`body { background: url(/bg.png) }`))
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		}
+	}))
+	defer server.Close()
+
+	inTempDir(t)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/site.css", "/logo.png", "/bg.png"} {
+		if hits[path] != 1 {
+			t.Errorf("%s fetched %d times, want once", path, hits[path])
+		}
+	}
+}
+
+func TestMirrorWebsiteStaysInFolder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/%2e%2e/%2e%2e/escaped.html">a</a><img src="/%2e%2e/%2e%2e/escaped.png">`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("escaped"))
+	}))
+	defer server.Close()
+
+	// Run one level down, so that an escape lands where the test can see it
+	dir := inTempDir(t)
+	if err := os.Mkdir("run", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("run"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+
+	for _, name := range []string{"escaped.html", "escaped.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was saved outside the mirror: %v", name, err)
+		}
+	}
+}
+
+func TestMirrorWebsiteStreamsLinkedFiles(t *testing.T) {
+	big := bytes.Repeat([]byte("x"), 1<<20)
+	for _, target := range []string{"/big.zip", "/download"} {
+		t.Run(target, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					w.Header().Set("Content-Type", "text/html")
+					w.Write([]byte(`<a href="` + target + `">file</a>`))
+					return
+				}
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Write(big)
+			}))
+			defer server.Close()
+
+			// Read whole, the file would be saved before the quota is checked
+			setQuota(t, 1000, true)
+			dir := inTempDir(t)
+			MirrorWebsite(server.URL+"/", nil, nil, false)
+
+			u, _ := url.Parse(server.URL)
+			if info, err := os.Stat(filepath.Join(dir, u.Host, target)); err == nil && info.Size() >= int64(len(big)) {
+				t.Errorf("%s was saved whole despite --quota-abort", target)
+			}
+		})
+	}
+}
@@ -1,129 +1,438 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 )
 
+// DownloadFile saves urlStr to fileName. When fileName is empty or ends in
+// a path separator (see DirTarget), the file is saved in that directory
+// under a name taken from the URL or, if enabled, from the server.
 func DownloadFile(urlStr, fileName string, background bool, rateLimit int64) error {
-    startTime := time.Now().Format("2006-01-02 15:04:05")
-    fmt.Printf("start at %s\n", startTime)
-
-    client := &http.Client{}
-    req, err := http.NewRequest("GET", urlStr, nil)
-    if err != nil {
-        return fmt.Errorf("error creating request: %v", err)
-    }
-
-    req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
-
-    resp, err := client.Do(req)
-    if err != nil {
-        return fmt.Errorf("error: %v", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode != http.StatusOK {
-        return fmt.Errorf("error: got status %s", resp.Status)
-    }
-    fmt.Printf("sending request, awaiting response... status %s\n", resp.Status)
-
-    contentLength := resp.ContentLength
-    fmt.Printf("content size: %d [~%.2fMB]\n", contentLength, float64(contentLength)/1000/1000)
-
-    out, err := os.Create(fileName)
-    if err != nil {
-        return fmt.Errorf("error: %v", err)
-    }
-    defer out.Close()
-
-    fmt.Printf("saving file to: ./%s\n", fileName)
-
-    var reader io.Reader = resp.Body
-    if rateLimit > 0 {
-        fmt.Printf("Rate limit set to: %.2f KB/s\n", float64(rateLimit)/1024)
-        reader = NewRateLimitReader(resp.Body, rateLimit)
-    }
-
-    if background {
-        _, err := io.Copy(out, reader)
-        if err != nil {
-            return fmt.Errorf("error: %v", err)
-        }
-    } else {
-        bar := NewProgressBar(contentLength, 50)
-        bar.StartTimer()
-
-        _, err = io.Copy(io.MultiWriter(out, bar), reader)
-        if err != nil {
-            return fmt.Errorf("error: %v", err)
-        }
-    }
-
-    endTime := time.Now().Format("2006-01-02 15:04:05")
-    fmt.Printf("Downloaded [%s]\nfinished at %s\n", urlStr, endTime)
-
-    return nil
+	startTime := time.Now().Format("2006-01-02 15:04:05")
+	logf("start at %s\n", startTime)
+	trustHost(urlStr)
+	if spider {
+		return checkURL(urlStr)
+	}
+	if err := checkQuota(urlStr); err != nil {
+		return err
+	}
+
+	t := &transfer{
+		url:        urlStr,
+		background: background,
+		rateLimit:  rateLimit,
+		resume:     continueDownload,
+	}
+	if isStdout(fileName) {
+		return t.toStdout()
+	}
+	if isDirTarget(fileName) {
+		t.dir = fileName
+	} else {
+		t.fileName = fileName
+	}
+
+	if _, err := os.Stat(t.fileName); noClobber && t.fileName != "" && err == nil {
+		logf("File '%s' already there; not retrieving.\n", t.fileName)
+		return nil
+	}
+
+	if err := withRetry(urlStr, t.attempt); err != nil {
+		return err
+	}
+	if t.skipped {
+		return nil
+	}
+	if timestamping && t.header != nil {
+		saveTimestamp(t.fileName, t.header)
+	}
+
+	endTime := time.Now().Format("2006-01-02 15:04:05")
+	logf("Downloaded [%s]\nfinished at %s\n", urlStr, endTime)
+
+	return nil
+}
+
+// transfer is the state of one DownloadFile call, kept across retries.
+type transfer struct {
+	url        string
+	fileName   string // where the file is saved; chosen on the first response when empty
+	dir        string // directory for a file whose name is not chosen yet
+	background bool
+	rateLimit  int64
+
+	// resume is set by -c, and after a failed attempt has left a usable
+	// prefix of the body in the .part file, so that the next attempt
+	// continues it.
+	resume bool
+
+	reserved bool // the name was picked to not overwrite anything
+
+	skipped bool        // -nc or -N found nothing to fetch
+	header  http.Header // headers of the response the file came from
+}
+
+// attempt makes a single try at saving the file.
+func (t *transfer) attempt() error {
+	var offset int64
+	var inPlace bool
+	if t.resume && !saveHeaders {
+		// With --save-headers the file does not line up with the body
+		offset, inPlace = resumeOffset(t.path())
+	}
+
+	resp, err := t.request(offset)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	defer func() { resp.Body.Close() }()
+
+	if t.fileName == "" {
+		// Do not claim a name for an error page
+		if resp.StatusCode >= 400 && offset == 0 {
+			return fmt.Errorf("error: %w", newStatusError(resp))
+		}
+
+		guess := t.path()
+		name := filepath.Join(t.dir, serverFileName(t.url, resp))
+		if !t.resume && !timestamping {
+			// -c and -N work on the existing file; otherwise never overwrite it
+			name, err = reserveFileName(name)
+			if errors.Is(err, errFileExists) {
+				logf("File '%s' already there; not retrieving.\n", name)
+				t.skipped = true
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+			t.reserved = true
+		}
+		t.fileName = name
+
+		// The offset was measured on the name the URL suggested; if the
+		// server named the file differently, ask again for the right part.
+		if t.fileName != guess && offset > 0 {
+			offset, inPlace = resumeOffset(t.fileName)
+			if err := t.reissue(&resp, offset); err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+		}
+	}
+
+	if offset > 0 {
+		switch resp.StatusCode {
+		case http.StatusRequestedRangeNotSatisfiable:
+			logf("sending request, awaiting response... status %s\n", resp.Status)
+			logf("the file is already fully retrieved; nothing to do.\n")
+			if inPlace {
+				return t.verifyFile(t.fileName)
+			}
+			if err := t.verifyFile(partName(t.fileName)); err != nil {
+				return err
+			}
+			return placePart(t.fileName, t.reserved)
+		case http.StatusPartialContent:
+			start, _, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+			if err == nil && start == offset {
+				if inPlace {
+					// Only now is the partial file known to be continued
+					if err := adoptPartial(t.fileName); err != nil {
+						return fmt.Errorf("error: %w", err)
+					}
+				}
+				break
+			}
+			// The server answered with a range we did not ask for, so the
+			// partial file cannot be trusted to line up; start over.
+			logf("server returned an unexpected range, restarting download\n")
+			offset = 0
+			if err := t.reissue(&resp, 0); err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+		case http.StatusOK:
+			logf("server does not support resuming, restarting download\n")
+			offset = 0
+		}
+	}
+
+	if timestamping && offset == 0 {
+		if resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusOK && !remoteIsNewer(resp, t.fileName) {
+			logf("Server file no newer than local file '%s' -- not retrieving.\n", t.fileName)
+			t.skipped = true
+			return nil
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK && !(offset > 0 && resp.StatusCode == http.StatusPartialContent) {
+		return fmt.Errorf("error: %w", newStatusError(resp))
+	}
+	t.header = resp.Header
+	logf("sending request, awaiting response... status %s\n", resp.Status)
+
+	contentLength := resp.ContentLength
+	if offset > 0 && contentLength >= 0 {
+		contentLength += offset
+	}
+	logf("content size: %d [~%.2fMB]\n", contentLength, float64(contentLength)/1000/1000)
+	logCompression(resp.Body)
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+		logf("resuming from byte %d\n", offset)
+	}
+	// Nothing appears under the final name until the body is complete
+	out, err := os.OpenFile(partName(t.fileName), flags, 0644)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	defer out.Close()
+
+	logf("saving file to: ./%s\n", t.fileName)
+
+	fileLength := contentLength
+	if saveHeaders {
+		block := headerBlock(resp)
+		if _, err := out.Write(block); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		if fileLength >= 0 {
+			fileLength += int64(len(block))
+		}
+	}
+
+	// Bytes count against -Q as they are written
+	progress := io.MultiWriter(newProgress(resp.Body, contentLength, offset, t.background), &quotaWriter{url: t.url})
+
+	// The digest is computed as the body streams in, starting with whatever
+	// an earlier attempt already wrote
+	want, err := expectedChecksum(t.url, t.fileName)
+	if err != nil {
+		return err
+	}
+	var hasher hash.Hash
+	writers := []io.Writer{out, progress}
+	if want != nil {
+		hasher = want.newHash()
+		if err := hashFile(hasher, partName(t.fileName), offset); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		writers = append(writers, hasher)
+	}
+
+	var reader io.Reader = resp.Body
+	var limiter *RateLimitReader
+	if t.rateLimit > 0 {
+		logf("Rate limit set to: %.2f KB/s\n", float64(t.rateLimit)/1024)
+		reader, limiter = limitBody(resp.Body, t.rateLimit)
+	}
+
+	if segments > 1 && offset == 0 && !saveHeaders && canSegment(resp) {
+		logf("downloading in %d segments\n", segments)
+		// Ask for the ranges where the redirects ended rather than follow them again
+		if err := downloadSegments(finalURL(resp, t.url), out, contentLength, segments, resp.Body, limiter, progress); err != nil {
+			// A failed segmented download leaves holes, so it cannot be resumed
+			out.Close()
+			os.Remove(partName(t.fileName))
+			return fmt.Errorf("error: %w", err)
+		}
+		// Segments arrive out of order, so hash the assembled file instead
+		if hasher != nil {
+			if err := hashFile(hasher, partName(t.fileName), -1); err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+		}
+	} else {
+		if segments > 1 && offset == 0 && !saveHeaders {
+			logf("server does not support ranges, using a single stream\n")
+		}
+		if _, err := io.Copy(io.MultiWriter(writers...), reader); err != nil {
+			// What arrived so far is only worth keeping if it can be resumed
+			t.resume = t.resume || resp.Header.Get("Accept-Ranges") == "bytes" || offset > 0
+			return fmt.Errorf("error: %w", err)
+		}
+	}
+	if !t.background && contentLength < 0 {
+		logf("\n\n")
+	}
+
+	if want != nil {
+		if err := want.verify(hasher); err != nil {
+			out.Close()
+			os.Remove(partName(t.fileName))
+			return fmt.Errorf("error: %w", err)
+		}
+		logf("checksum OK (%s)\n", want.algo)
+	}
+
+	if err := commitPart(out, t.fileName, fileLength, t.reserved); err != nil {
+		t.resume = true
+		return fmt.Errorf("error: %w", err)
+	}
+	return nil
+}
+
+// verifyFile checks the complete file at path, the .part file or the file
+// itself, against the expected digest, deleting it on a mismatch.
+func (t *transfer) verifyFile(path string) error {
+	want, err := expectedChecksum(t.url, t.fileName)
+	if err != nil || want == nil {
+		return err
+	}
+
+	hasher := want.newHash()
+	if err := hashFile(hasher, path, -1); err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	if err := want.verify(hasher); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("error: %w", err)
+	}
+	return nil
+}
+
+// path returns where the file is, or would be, saved. Until the server has
+// answered, an auto-named file is assumed to take its name from the URL.
+func (t *transfer) path() string {
+	if t.fileName != "" {
+		return t.fileName
+	}
+	return filepath.Join(t.dir, GetFileName(t.url))
+}
+
+// request issues the GET for this transfer. A positive offset asks the
+// server for the remainder of the file starting at that byte; otherwise,
+// with -N, the request is made conditional on the local copy being stale.
+func (t *transfer) request(offset int64) (*http.Response, error) {
+	req, err := newRequest(t.url)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else if timestamping {
+		addConditions(req, t.path())
+	}
+	return httpClient().Do(req)
+}
+
+// reissue replaces *resp with the response to a new request from offset,
+// closing the old body. If the request fails *resp is left in place, so the
+// caller's deferred close still has a body to close.
+func (t *transfer) reissue(resp **http.Response, offset int64) error {
+	(*resp).Body.Close()
+	next, err := t.request(offset)
+	if err != nil {
+		return err
+	}
+	*resp = next
+	return nil
+}
+
+// requestRange issues a GET for bytes start through end of urlStr.
+func requestRange(urlStr string, start, end int64) (*http.Response, error) {
+	req, err := newRequest(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	return httpClient().Do(req)
 }
 
 // Create a WaitGroup to track background downloads
 var downloadWg sync.WaitGroup
 
 func DownloadWithLogging(urlStr string, fileName string, background bool, rateLimit int64) {
-    if background {
-        fmt.Println("Output will be written to 'wget-log'.")
-        
-        // Add to WaitGroup before starting goroutine
-        downloadWg.Add(1)
-        
-        go func() {
-            // Ensure WaitGroup is decremented when done
-            defer downloadWg.Done()
-            
-            logFile, err := os.Create("wget-log")
-            if err != nil {
-                fmt.Printf("Error: %v\n", err)
-                return
-            }
-            defer logFile.Close()
-
-            // Create new files for stdout and stderr
-            oldStdout := os.Stdout
-            oldStderr := os.Stderr
-            os.Stdout = logFile
-            os.Stderr = logFile
-            
-            // Restore original stdout/stderr when done
-            defer func() {
-                os.Stdout = oldStdout
-                os.Stderr = oldStderr
-            }()
-
-            err1 := DownloadFile(urlStr, fileName, background, rateLimit)
-            if err1 != nil {
-                fmt.Fprintln(logFile, "Error:", err1)
-            }
-        }()
-
-        // Wait a moment for the download to start
-        time.Sleep(1 * time.Second)
-        
-        // Wait for background download to complete
-        downloadWg.Wait()
-    } else {
-        err := DownloadFile(urlStr, fileName, background, rateLimit)
-        if err != nil {
-            fmt.Println(err)
-        }
-    }
+	if background {
+		logf("Output will be written to 'wget-log'.\n")
+
+		// Add to WaitGroup before starting goroutine
+		downloadWg.Add(1)
+
+		go func() {
+			// Ensure WaitGroup is decremented when done
+			defer downloadWg.Done()
+
+			logFile, err := os.Create("wget-log")
+			if err != nil {
+				logf("Error: %v\n", err)
+				return
+			}
+			defer logFile.Close()
+
+			// Create new files for stdout and stderr
+			oldStdout := os.Stdout
+			oldStderr := os.Stderr
+			os.Stdout = logFile
+			os.Stderr = logFile
+
+			// Restore original stdout/stderr when done
+			defer func() {
+				os.Stdout = oldStdout
+				os.Stderr = oldStderr
+			}()
+
+			err1 := DownloadFile(urlStr, fileName, background, rateLimit)
+			if err1 != nil {
+				fmt.Fprintln(logFile, "Error:", err1)
+			}
+		}()
+
+		// Wait a moment for the download to start
+		time.Sleep(1 * time.Second)
+
+		// Wait for background download to complete
+		downloadWg.Wait()
+	} else {
+		err := DownloadFile(urlStr, fileName, background, rateLimit)
+		if err != nil {
+			logf("%v\n", err)
+		}
+	}
 }
 
-func GetFileName(url string) string {
-    s := strings.Split(url, "/")
-    return s[len(s)-1]
-}
\ No newline at end of file
+// GetFileName derives a local file name from the last path segment of a URL,
+// ignoring any query string or fragment. URLs that end in a slash map to
+// "index.html".
+func GetFileName(urlStr string) string {
+	urlPath := urlStr
+	if u, err := url.Parse(urlStr); err == nil {
+		urlPath = u.Path
+	} else {
+		urlPath, _, _ = strings.Cut(urlPath, "#")
+		urlPath, _, _ = strings.Cut(urlPath, "?")
+	}
+
+	name := urlPath[strings.LastIndex(urlPath, "/")+1:]
+	if name == "" || name == "." || name == ".." {
+		return "index.html"
+	}
+	return name
+}
+
+// DirTarget returns a DownloadFile target that saves into dir, letting the
+// name be chosen from the URL or the server's response. An empty dir means
+// the current directory.
+func DirTarget(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Clean(dir) + string(filepath.Separator)
+}
+
+// isDirTarget reports whether fileName is a directory target from DirTarget.
+func isDirTarget(fileName string) bool {
+	return fileName == "" || strings.HasSuffix(fileName, "/") || strings.HasSuffix(fileName, string(filepath.Separator))
+}
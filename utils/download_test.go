@@ -87,8 +87,13 @@ func TestGetFileName(t *testing.T) {
 	}{
 		{"http://example.com/file.txt", "file.txt"},
 		{"http://example.com/path/to/file.txt", "file.txt"},
-		{"http://example.com/", ""},
-		{"http://example.com/path/to/", ""},
+		{"http://example.com/", "index.html"},
+		{"http://example.com/path/to/", "index.html"},
+		{"http://example.com", "index.html"},
+		{"https://host/download?id=42", "download"},
+		{"https://host/dir/?page=2", "index.html"},
+		{"http://example.com/file.txt#section", "file.txt"},
+		{"http://example.com/my%20file.txt", "my file.txt"},
 	}
 
 	for _, tt := range tests {
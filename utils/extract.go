@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// cssURLPatterns find the URLs a stylesheet refers to.
+var cssURLPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`url\(\s*['"]?([^'"()]+?)['"]?\s*\)`),
+	regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`),
+}
+
+// htmlLink is a URL referred to by an HTML document.
+type htmlLink struct {
+	raw      string // as written in the document, entities decoded
+	absolute string // resolved against the document's base URL
+	page     bool   // a link to another page, rather than part of this one
+	nofollow bool   // marked rel="nofollow"
+}
+
+// requisiteRels are the <link rel> values that make the linked file part of
+// the page rather than another page.
+var requisiteRels = map[string]bool{
+	"stylesheet": true, "icon": true, "shortcut": true, "apple-touch-icon": true,
+	"apple-touch-icon-precomposed": true, "mask-icon": true, "manifest": true,
+	"preload": true, "prefetch": true, "modulepreload": true,
+}
+
+// How an attribute holds its URLs.
+const (
+	plainURL    = iota // the whole value is one URL
+	srcsetURLs         // a srcset list of candidates
+	refreshURLs        // a <meta http-equiv="refresh"> content value
+	cssURLs            // inline CSS
+)
+
+// urlAttr is an attribute of a tag that holds URLs.
+type urlAttr struct {
+	key      string
+	form     int
+	page     bool // the URLs lead to other pages
+	nofollow bool // rel="nofollow" asks crawlers not to follow them
+}
+
+// tagURLAttrs returns the attributes of tok that may hold URLs.
+func tagURLAttrs(tok html.Token) []urlAttr {
+	attrs := []urlAttr{{key: "style", form: cssURLs}}
+	rels := strings.Fields(strings.ToLower(attrValue(tok, "rel")))
+	nofollow := false
+	for _, r := range rels {
+		nofollow = nofollow || r == "nofollow"
+	}
+	switch tok.Data {
+	case "a", "area":
+		attrs = append(attrs, urlAttr{key: "href", page: true, nofollow: nofollow})
+	case "link":
+		requisite := false
+		for _, r := range rels {
+			requisite = requisite || requisiteRels[r]
+		}
+		attrs = append(attrs, urlAttr{key: "href", page: !requisite, nofollow: nofollow})
+	case "frame", "iframe":
+		attrs = append(attrs, urlAttr{key: "src", page: true})
+	case "img", "source":
+		attrs = append(attrs, urlAttr{key: "src"}, urlAttr{key: "srcset", form: srcsetURLs})
+	case "script", "audio", "track", "embed":
+		attrs = append(attrs, urlAttr{key: "src"})
+	case "video":
+		attrs = append(attrs, urlAttr{key: "src"}, urlAttr{key: "poster"})
+	case "object":
+		attrs = append(attrs, urlAttr{key: "data"})
+	case "input":
+		if strings.EqualFold(attrValue(tok, "type"), "image") {
+			attrs = append(attrs, urlAttr{key: "src"})
+		}
+	case "body", "table", "td", "th":
+		attrs = append(attrs, urlAttr{key: "background"})
+	case "meta":
+		if strings.EqualFold(attrValue(tok, "http-equiv"), "refresh") {
+			attrs = append(attrs, urlAttr{key: "content", form: refreshURLs, page: true})
+		} else if name := strings.ToLower(attrValue(tok, "property") + attrValue(tok, "name")); strings.HasSuffix(name, "image") {
+			// og:image, twitter:image and the like
+			attrs = append(attrs, urlAttr{key: "content"})
+		}
+	}
+	return attrs
+}
+
+// attrValue returns the value of tok's attribute key, or "".
+func attrValue(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// attrURLs returns the URLs in an attribute value of the given form.
+func attrURLs(form int, value string) []string {
+	switch form {
+	case srcsetURLs:
+		return parseSrcset(value)
+	case refreshURLs:
+		return []string{refreshURL(value)}
+	case cssURLs:
+		return cssLinks(value)
+	}
+	return []string{value}
+}
+
+// extractLinks finds the URLs in htmlContent, served from pageURL, by
+// walking its tags. Only attributes that hold URLs are read, so text,
+// comments and scripts are ignored. URLs are resolved against
+// documentBase. Each URL is reported once, in document order.
+func extractLinks(htmlContent, pageURL string) []htmlLink {
+	var links []htmlLink
+	seen := make(map[htmlLink]bool)
+	add := func(raw string, page, nofollow bool) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			return
+		}
+		link := htmlLink{raw: raw, page: page, nofollow: nofollow}
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	inStyle := false
+	z := html.NewTokenizer(strings.NewReader(htmlContent))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.TextToken:
+			if inStyle {
+				for _, raw := range cssLinks(string(z.Text())) {
+					add(raw, false, false)
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "style" {
+				inStyle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.Data == "style" {
+				inStyle = tt == html.StartTagToken
+			}
+			for _, attr := range tagURLAttrs(tok) {
+				for _, raw := range attrURLs(attr.form, attrValue(tok, attr.key)) {
+					add(raw, attr.page, attr.nofollow)
+				}
+			}
+		}
+	}
+
+	base := documentBase(htmlContent, pageURL)
+	resolved := links[:0]
+	for _, link := range links {
+		link.absolute = resolveURL(base, link.raw)
+		if isWebURL(link.absolute) {
+			resolved = append(resolved, link)
+		}
+	}
+	return resolved
+}
+
+// documentBase returns the URL that links in htmlContent, served from
+// pageURL, are relative to: that of its first <base href>, if any.
+func documentBase(htmlContent, pageURL string) string {
+	z := html.NewTokenizer(strings.NewReader(htmlContent))
+	for tt := z.Next(); tt != html.ErrorToken; tt = z.Next() {
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		if tok := z.Token(); tok.Data == "base" {
+			if href := strings.TrimSpace(attrValue(tok, "href")); href != "" {
+				if base := resolveURL(pageURL, href); base != "" {
+					return base
+				}
+			}
+		}
+	}
+	return pageURL
+}
+
+// isWebURL reports whether urlStr is an http or https URL.
+func isWebURL(urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// cssLinks returns the url() and @import references of a stylesheet or a
+// style attribute, as written.
+func cssLinks(css string) []string {
+	var links []string
+	for _, pattern := range cssURLPatterns {
+		for _, match := range pattern.FindAllStringSubmatch(css, -1) {
+			links = append(links, match[1])
+		}
+	}
+	return links
+}
+
+// parseSrcset returns the URLs of a srcset attribute: a comma-separated
+// list of candidates, each a URL followed by an optional width or density.
+func parseSrcset(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// refreshURL returns the URL of a <meta http-equiv="refresh"> content
+// value such as "5; url=/next", or "" if there is none.
+func refreshURL(content string) string {
+	_, rest, ok := strings.Cut(content, ";")
+	if !ok {
+		_, rest, ok = strings.Cut(content, ",")
+	}
+	if !ok {
+		return ""
+	}
+	rest = strings.TrimSpace(rest)
+	if len(rest) >= 4 && strings.EqualFold(rest[:3], "url") {
+		if after, found := strings.CutPrefix(strings.TrimSpace(rest[3:]), "="); found {
+			rest = after
+		}
+	}
+	return strings.Trim(strings.TrimSpace(rest), `'"`)
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	doc := `<!DOCTYPE html>
+<html><head>
+<base href="/assets/">
+<link rel="stylesheet" href="site.css">
+<link rel="canonical" href="/canonical">
+<meta http-equiv="refresh" content="5; URL='/next.html'">
+<meta property="og:image" content="share.jpg">
+<style>@import "print.css"; .hero { background: url(hero.png) }</style>
+<script>var fake = '<img src="in-script.png">';</script>
+</head>
+<body style="background-image: url('body.png')">
+<!-- <img src="commented.png"> -->
+<p>Plain text mentioning src="in-text.png"</p>
+<img src=unquoted.png srcset="small.png 480w, large.png 1080w">
+<picture><source srcset="photo.webp 1x, photo@2x.webp 2x"><img src="photo.jpg"></picture>
+<video src="movie.mp4" poster="poster.jpg"><track src="subs.vtt"></video>
+<object data="applet.swf"></object>
+<a href="page.html#section">page</a>
+<a href="mailto:me@example.com">mail</a>
+<a href="javascript:void(0)">js</a>
+<a href="#top">top</a>
+<img src="unquoted.png">
+</body></html>`
+
+	got := make(map[string]htmlLink)
+	var order []string
+	for _, link := range extractLinks(doc, "http://example.com/dir/index.html") {
+		got[link.raw] = link
+		order = append(order, link.raw)
+	}
+
+	requisites := map[string]string{
+		"site.css":      "http://example.com/assets/site.css",
+		"share.jpg":     "http://example.com/assets/share.jpg",
+		"print.css":     "http://example.com/assets/print.css",
+		"hero.png":      "http://example.com/assets/hero.png",
+		"body.png":      "http://example.com/assets/body.png",
+		"unquoted.png":  "http://example.com/assets/unquoted.png",
+		"small.png":     "http://example.com/assets/small.png",
+		"large.png":     "http://example.com/assets/large.png",
+		"photo.webp":    "http://example.com/assets/photo.webp",
+		"photo@2x.webp": "http://example.com/assets/photo@2x.webp",
+		"photo.jpg":     "http://example.com/assets/photo.jpg",
+		"movie.mp4":     "http://example.com/assets/movie.mp4",
+		"poster.jpg":    "http://example.com/assets/poster.jpg",
+		"subs.vtt":      "http://example.com/assets/subs.vtt",
+		"applet.swf":    "http://example.com/assets/applet.swf",
+	}
+	pages := map[string]string{
+		"/canonical":        "http://example.com/canonical",
+		"/next.html":        "http://example.com/next.html",
+		"page.html#section": "http://example.com/assets/page.html#section",
+	}
+
+	for raw, want := range requisites {
+		if link, ok := got[raw]; !ok || link.page || link.absolute != want {
+			t.Errorf("requisite %q = %+v, want %s", raw, link, want)
+		}
+	}
+	for raw, want := range pages {
+		if link, ok := got[raw]; !ok || !link.page || link.absolute != want {
+			t.Errorf("page link %q = %+v, want %s", raw, link, want)
+		}
+	}
+	if len(order) != len(requisites)+len(pages) {
+		t.Errorf("found %d links, want %d: %q", len(order), len(requisites)+len(pages), order)
+	}
+}
+
+func TestRefreshURL(t *testing.T) {
+	tests := map[string]string{
+		"0; url=/next":      "/next",
+		"5;URL='/quoted'":   "/quoted",
+		`3; url="/double"`:  "/double",
+		"10, url = /spaced": "/spaced",
+		"30":                "",
+	}
+	for content, want := range tests {
+		if got := refreshURL(content); got != want {
+			t.Errorf("refreshURL(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	got := parseSrcset(" a.png 1x,b.png  2x , c.png")
+	if want := []string{"a.png", "b.png", "c.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSrcset = %q, want %q", got, want)
+	}
+}
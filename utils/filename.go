@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Naming options, set by --content-disposition, --trust-server-names and
+// -nc/--no-clobber.
+var (
+	contentDisposition bool
+	trustServerNames   bool
+	noClobber          bool
+)
+
+// errFileExists is returned by reserveFileName when -nc forbids touching
+// an existing file.
+var errFileExists = errors.New("file already exists")
+
+// reservedNames holds every path claimed during this run, so concurrent
+// downloads never pick the same one even before it shows up on disk.
+var (
+	reservedMu    sync.Mutex
+	reservedNames = make(map[string]bool)
+)
+
+// serverFileName picks the name for a file whose name was not given with
+// -O. The Content-Disposition filename wins when --content-disposition is
+// set, then the last URL in the redirect chain with --trust-server-names,
+// and otherwise the URL that was asked for.
+func serverFileName(urlStr string, resp *http.Response) string {
+	if contentDisposition {
+		if name := dispositionFileName(resp.Header.Get("Content-Disposition")); name != "" {
+			return name
+		}
+	}
+	if trustServerNames {
+		return GetFileName(finalURL(resp, urlStr))
+	}
+	return GetFileName(urlStr)
+}
+
+// dispositionFileName extracts the filename from a Content-Disposition
+// header. An RFC 5987 "filename*=" parameter takes precedence over plain
+// "filename=". Any directory part is dropped so the server cannot make us
+// write outside the target directory; "" means no usable name was given.
+func dispositionFileName(header string) string {
+	if header == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+
+	// mime decodes filename* into "filename" and prefers it when both exist
+	name := params["filename"]
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, 0) {
+		return ""
+	}
+	return filepath.Clean(name)
+}
+
+// reserveFileName claims name for this download. If a file of that name
+// exists or another download in this run has claimed it, the first free
+// "name.1", "name.2", ... is used instead, as GNU wget does; with -nc,
+// errFileExists is returned. Claims are made under a lock, so concurrent
+// downloads never pick the same path.
+func reserveFileName(name string) (string, error) {
+	reservedMu.Lock()
+	defer reservedMu.Unlock()
+
+	for n := 0; ; n++ {
+		candidate := name
+		if n > 0 {
+			if noClobber {
+				return name, errFileExists
+			}
+			candidate = fmt.Sprintf("%s.%d", name, n)
+		}
+		if reservedNames[candidate] {
+			continue
+		}
+		if _, err := os.Lstat(candidate); err == nil {
+			continue
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		reservedNames[candidate] = true
+		return candidate, nil
+	}
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDispositionFileName(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{`attachment; filename="report.pdf"`, "report.pdf"},
+		{`attachment; filename=report.pdf`, "report.pdf"},
+		{`attachment; filename*=UTF-8''na%C3%AFve%20file.txt`, "naïve file.txt"},
+		{`attachment; filename="plain.txt"; filename*=UTF-8''fancy.txt`, "fancy.txt"},
+		{`attachment; filename="../../etc/passwd"`, "passwd"},
+		{`attachment; filename="C:\\temp\\evil.exe"`, "evil.exe"},
+		{`attachment; filename=".."`, ""},
+		{`inline`, ""},
+		{``, ""},
+	}
+
+	for _, tt := range tests {
+		if got := dispositionFileName(tt.header); got != tt.expected {
+			t.Errorf("dispositionFileName(%q) = %q; want %q", tt.header, got, tt.expected)
+		}
+	}
+}
+
+func TestDownloadFileServerNames(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+		w.Write([]byte("a,b,c"))
+	})
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/files/release-1.2.tar.gz?token=abc", http.StatusFound)
+	})
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tarball"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name               string
+		path               string
+		contentDisposition bool
+		trustServerNames   bool
+		expected           string
+	}{
+		{"URL name without query", "/download?id=42", false, false, "download"},
+		{"Content-Disposition", "/download?id=42", true, false, "report.csv"},
+		{"Redirect target ignored", "/latest", false, false, "latest"},
+		{"Trust server names", "/latest", false, true, "release-1.2.tar.gz"},
+		{"Trailing slash", "/files/", false, false, "index.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentDisposition, trustServerNames = tt.contentDisposition, tt.trustServerNames
+			defer func() { contentDisposition, trustServerNames = false, false }()
+
+			dir := t.TempDir()
+			if err := DownloadFile(server.URL+tt.path, DirTarget(dir), true, 0); err != nil {
+				t.Fatalf("DownloadFile failed: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.expected)); err != nil {
+				entries, _ := os.ReadDir(dir)
+				t.Errorf("expected %s to be saved, directory has %v", tt.expected, entries)
+			}
+		})
+	}
+}
+
+func TestDownloadFileServerNameResumeFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" {
+			// The request for the server-named file fails
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+		w.Write([]byte("a,b,c"))
+	}))
+	defer server.Close()
+
+	contentDisposition, continueDownload = true, true
+	defer func() { contentDisposition, continueDownload = false, false }()
+
+	// The part file goes by the URL's name, so the server's name starts over
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "download.part"), []byte("a,"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownloadFile(server.URL+"/download", DirTarget(dir), true, 0); err == nil {
+		t.Fatal("expected an error when the request for the server's name fails")
+	}
+}
+
+func TestDirTarget(t *testing.T) {
+	if got := DirTarget(""); got != "" {
+		t.Errorf("DirTarget(\"\") = %q; want \"\"", got)
+	}
+	target := DirTarget("downloads/")
+	if !isDirTarget(target) {
+		t.Errorf("DirTarget(\"downloads/\") = %q is not recognised as a directory", target)
+	}
+	if isDirTarget(filepath.Join("downloads", "file.txt")) {
+		t.Error("a file path was treated as a directory target")
+	}
+}
+
+func TestReserveFileName(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(name, []byte("existing"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	first, err := reserveFileName(name)
+	if err != nil {
+		t.Fatalf("reserveFileName failed: %v", err)
+	}
+	second, err := reserveFileName(name)
+	if err != nil {
+		t.Fatalf("reserveFileName failed: %v", err)
+	}
+	if first != name+".1" || second != name+".2" {
+		t.Errorf("reserveFileName gave %q and %q; want %q and %q", first, second, name+".1", name+".2")
+	}
+
+	noClobber = true
+	defer func() { noClobber = false }()
+	if _, err := reserveFileName(name); err != errFileExists {
+		t.Errorf("expected errFileExists with -nc, got %v", err)
+	}
+}
+
+func TestDownloadFileNoClobber(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new content"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(existing, []byte("old content"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	// By default the new download gets a numbered name
+	if err := DownloadFile(server.URL+"/file.txt", DirTarget(dir), true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(existing + ".1"); string(got) != "new content" {
+		t.Errorf("file.txt.1 has %q; want %q", got, "new content")
+	}
+
+	// With -nc nothing is written at all
+	noClobber = true
+	defer func() { noClobber = false }()
+	for _, target := range []string{DirTarget(dir), existing} {
+		if err := DownloadFile(server.URL+"/file.txt", target, true, 0); err != nil {
+			t.Fatalf("DownloadFile failed: %v", err)
+		}
+	}
+	if got, _ := os.ReadFile(existing); string(got) != "old content" {
+		t.Errorf("-nc overwrote file.txt with %q", got)
+	}
+	if _, err := os.Stat(existing + ".2"); err == nil {
+		t.Error("-nc created file.txt.2")
+	}
+}
+
+func TestDownloadFilesConcurrentlySameName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	urls := []string{server.URL + "/data.json?a", server.URL + "/data.json?b", server.URL + "/data.json?c"}
+	if err := DownloadFilesConcurrently(urls, "", true, 0, dir); err != nil {
+		t.Fatalf("DownloadFilesConcurrently failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range []string{"data.json", "data.json.1", "data.json.2"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+			continue
+		}
+		seen[string(got)] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("downloads overwrote each other; saw bodies %v", seen)
+	}
+}
@@ -20,15 +20,25 @@ func CheckFlags() (output, url string, tolog bool, file string, rateLimit int64,
 	excludeFlag := flag.String("X", "", "Exclude directories (comma-separated)")
 	convertLinksFlag := flag.Bool("convert-links", false, "Convert links for offline viewing")
 
+	registerDownloadFlags()
+
 	// Long-form versions of short flags
 	flag.StringVar(rejectFlag, "reject", "", "Reject file suffixes (comma-separated)")
 	flag.StringVar(excludeFlag, "exclude", "", "Exclude directories (comma-separated)")
 
 	flag.Parse()
 
+	if recursive {
+		// -r crawls like --mirror, only not as deep by default
+		*mirrorFlag = true
+		if crawlLevel < 0 {
+			crawlLevel = 5
+		}
+	}
+
 	if *inputFile == "" {
 		if flag.NArg() < 1 && !*mirrorFlag {
-			fmt.Println("Usage: go run . [-O filename] [-P path] [-B] [-i urlfile] [--rate-limit rate] [--mirror] [-R suffixes] [-X directories] [--convert-links] <URL>")
+			fmt.Println("Usage: go run . [-O filename] [-P path] [-B] [-i urlfile] [--rate-limit rate] [-c] [--segments n] [--tries n] [--timeout secs] [--mirror] [-r] [-l depth] [-R suffixes] [-X directories] [--convert-links] <URL>")
 			return
 		}
 		if flag.NArg() > 0 {
@@ -38,7 +48,7 @@ func CheckFlags() (output, url string, tolog bool, file string, rateLimit int64,
 
 	limit, err := ParseRateLimit(*rateLimitFlag)
 	if err != nil {
-		fmt.Printf("Warning: Invalid rate limit format: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Warning: Invalid rate limit format: %v\n", err)
 	}
 
 	// Process new flags
@@ -56,6 +66,133 @@ func CheckFlags() (output, url string, tolog bool, file string, rateLimit int64,
 	return *outputFile, url, *log, *inputFile, limit, *mirrorFlag, reject, exclude, *convertLinksFlag, *pathFlag
 }
 
+// registerDownloadFlags defines the flags that tune how files are fetched.
+// They are stored directly in package-level settings rather than returned
+// from CheckFlags.
+func registerDownloadFlags() {
+	flag.BoolVar(&continueDownload, "c", false, "Resume getting a partially-downloaded file")
+	flag.BoolVar(&continueDownload, "continue", false, "Resume getting a partially-downloaded file")
+	flag.IntVar(&segments, "segments", 1, "Split a single download into this many parallel range requests")
+	flag.IntVar(&maxTries, "tries", 1, "Number of attempts per URL before giving up")
+	flag.Func("waitretry", "Longest wait in seconds between retries (default 10)", func(s string) (err error) {
+		waitRetry, err = parseSeconds(s)
+		return err
+	})
+	flag.Func("retry-on-http-error", "HTTP statuses to retry on (comma-separated, e.g. 503,429)", func(s string) (err error) {
+		retryOnHTTPError, err = parseStatusList(s)
+		return err
+	})
+	flag.BoolVar(&contentDisposition, "content-disposition", false, "Name files after the server's Content-Disposition header")
+	flag.BoolVar(&trustServerNames, "trust-server-names", false, "Name files after the last URL in a redirect chain")
+	flag.BoolVar(&noClobber, "nc", false, "Skip downloads that would overwrite existing files")
+	flag.BoolVar(&noClobber, "no-clobber", false, "Skip downloads that would overwrite existing files")
+	flag.BoolVar(&timestamping, "N", false, "Only download files newer than the local copy")
+	flag.BoolVar(&timestamping, "timestamping", false, "Only download files newer than the local copy")
+	flag.Func("checksum", "Expected digest of the download (e.g. sha256:9f86d0...)", func(s string) (err error) {
+		checksumFlag, err = parseChecksum(s)
+		return err
+	})
+	flag.StringVar(&checksumFile, "checksum-file", "", "Path or URL of a .sha256 sidecar or SHA256SUMS file to verify downloads against")
+	flag.Func("timeout", "Network timeout in seconds; sets the DNS, connect and read timeouts", func(s string) error {
+		d, err := parseSeconds(s)
+		connectTimeout, dnsTimeout, readTimeout = d, d, d
+		return err
+	})
+	flag.Func("connect-timeout", "Seconds to wait for a connection to be established", func(s string) (err error) {
+		connectTimeout, err = parseSeconds(s)
+		return err
+	})
+	flag.Func("dns-timeout", "Seconds to wait for a host name lookup", func(s string) (err error) {
+		dnsTimeout, err = parseSeconds(s)
+		return err
+	})
+	flag.Func("read-timeout", "Seconds a read may wait for data before giving up", func(s string) (err error) {
+		readTimeout, err = parseSeconds(s)
+		return err
+	})
+	flag.Func("header", "Extra request header \"Name: value\" (repeatable)", addHeader)
+	flag.StringVar(&userAgent, "user-agent", defaultUserAgent, "User-Agent header to send")
+	flag.Func("method", "HTTP method to use (default GET, or POST with a body)", func(s string) error {
+		requestMethod = strings.ToUpper(strings.TrimSpace(s))
+		return nil
+	})
+	flag.Func("post-data", "Send this string as a POST body", func(s string) error {
+		setBody([]byte(s))
+		return nil
+	})
+	flag.Func("post-file", "Send the contents of this file as a POST body (- for stdin)", func(s string) error {
+		data, err := readBodyFile(s)
+		setBody(data)
+		return err
+	})
+	flag.Func("body-data", "Send this string as the body of the --method request", func(s string) error {
+		setBody([]byte(s))
+		return nil
+	})
+	flag.StringVar(&httpUser, "user", "", "User name for HTTP authentication")
+	flag.StringVar(&httpPassword, "password", "", "Password for HTTP authentication")
+	flag.BoolVar(&askPassword, "ask-password", false, "Prompt for the HTTP password")
+	flag.StringVar(&bearerToken, "bearer-token", "", "Send this token as \"Authorization: Bearer\"")
+	flag.Func("proxy", "Proxy for all requests: http://, https:// or socks5:// URL", func(s string) (err error) {
+		proxyURL, err = parseProxyURL(s)
+		return err
+	})
+	flag.BoolVar(&noProxy, "no-proxy", false, "Ignore --proxy and the proxy environment variables")
+	flag.StringVar(&proxyUser, "proxy-user", "", "User name for proxy authentication")
+	flag.StringVar(&proxyPassword, "proxy-password", "", "Password for proxy authentication")
+	flag.StringVar(&caCertificate, "ca-certificate", "", "PEM file of certificate authorities to trust, besides the system ones")
+	flag.StringVar(&caDirectory, "ca-directory", "", "Directory of PEM certificate authority files to trust")
+	flag.StringVar(&clientCertificate, "certificate", "", "PEM client certificate for servers that require one")
+	flag.StringVar(&privateKey, "private-key", "", "PEM private key for --certificate, if not in the same file")
+	flag.BoolVar(&noCheckCertificate, "no-check-certificate", false, "Do not verify the server's certificate")
+	flag.Func("secure-protocol", "Lowest TLS version to accept: auto, TLSv1_2 or TLSv1_3", func(s string) (err error) {
+		minTLSVersion, err = parseSecureProtocol(s)
+		return err
+	})
+	flag.Func("pinnedpubkey", "Only accept servers whose public key has one of these hashes (sha256//<base64>;...)", func(s string) (err error) {
+		pinnedKeys, err = parsePinnedKeys(s)
+		return err
+	})
+	flag.Func("compression", "Ask for compressed transfers and decode them: auto, gzip or none (default none)", func(s string) (err error) {
+		compression, err = parseCompression(s)
+		return err
+	})
+	flag.IntVar(&maxRedirect, "max-redirect", 20, "Maximum number of redirections to follow per request")
+	flag.BoolVar(&refuseDowngrade, "refuse-downgrade", false, "Do not follow redirects from HTTPS to HTTP")
+	flag.BoolVar(&spider, "spider", false, "Check that URLs exist without downloading them")
+	flag.BoolVar(&serverResponse, "S", false, "Print the headers of every server response")
+	flag.BoolVar(&serverResponse, "server-response", false, "Print the headers of every server response")
+	flag.BoolVar(&saveHeaders, "save-headers", false, "Save the response headers ahead of the file contents")
+	setQuota := func(s string) (err error) {
+		quota, err = parseQuota(s)
+		return err
+	}
+	flag.Func("Q", "Stop starting downloads after this many bytes (e.g. 500M, 5G)", setQuota)
+	flag.Func("quota", "Stop starting downloads after this many bytes (e.g. 500M, 5G)", setQuota)
+	flag.BoolVar(&quotaAbort, "quota-abort", false, "Also stop downloads in progress when the quota is reached")
+	flag.BoolVar(&recursive, "r", false, "Follow links recursively, five levels deep unless -l says otherwise")
+	flag.BoolVar(&recursive, "recursive", false, "Follow links recursively, five levels deep unless -l says otherwise")
+	setLevel := func(s string) (err error) {
+		crawlLevel, err = parseLevel(s)
+		return err
+	}
+	flag.Func("l", "Maximum depth of recursion, or inf (default inf with --mirror, 5 with -r)", setLevel)
+	flag.Func("level", "Maximum depth of recursion, or inf (default inf with --mirror, 5 with -r)", setLevel)
+	setWait := func(s string) (err error) {
+		wait, err = parseSeconds(s)
+		return err
+	}
+	flag.Func("w", "Seconds to wait between requests to a host while crawling", setWait)
+	flag.Func("wait", "Seconds to wait between requests to a host while crawling", setWait)
+	flag.BoolVar(&randomWait, "random-wait", false, "Vary --wait between 0.5 and 1.5 times its value")
+	flag.IntVar(&maxPerHost, "max-per-host", 0, "Most parallel requests to one host while crawling (default no limit)")
+	flag.Func("e", "Run a wgetrc-style command; robots=off ignores robots.txt and nofollow", runCommand)
+	flag.Func("execute", "Run a wgetrc-style command; robots=off ignores robots.txt and nofollow", runCommand)
+	flag.StringVar(&loadCookiesFile, "load-cookies", "", "Load cookies from this cookies.txt file before the first request")
+	flag.StringVar(&saveCookiesFile, "save-cookies", "", "Save cookies to this cookies.txt file")
+	flag.BoolVar(&keepSessionCookies, "keep-session-cookies", false, "Also save cookies that expire with the session")
+}
+
 func removeEmptyStrings(s []string) []string {
 	var result []string
 	for _, str := range s {
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Response header options, set by -S/--server-response and --save-headers.
+var (
+	serverResponse bool
+	saveHeaders    bool
+)
+
+// responseLogTransport prints the headers of every response with -S,
+// including redirects and authentication challenges, as they came from the
+// server.
+type responseLogTransport struct {
+	base http.RoundTripper
+}
+
+func (t *responseLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && serverResponse {
+		logf("%s", formatResponseHeaders(resp))
+	}
+	return resp, err
+}
+
+// formatResponseHeaders renders the status line and headers of resp,
+// indented, one per line and with the names sorted.
+func formatResponseHeaders(resp *http.Response) string {
+	var b strings.Builder
+	b.WriteString("  " + resp.Proto + " " + resp.Status + "\n")
+
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			b.WriteString("  " + name + ": " + value + "\n")
+		}
+	}
+	return b.String()
+}
+
+// headerBlock returns the status line and headers of resp as they would
+// appear on the wire, ending with the blank line that separates them from
+// the body. --save-headers writes it ahead of the file.
+func headerBlock(resp *http.Response) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(resp.Proto + " " + resp.Status + "\r\n")
+	resp.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setHeaderOptions sets -S and --save-headers for a test.
+func setHeaderOptions(t *testing.T, print, save bool) {
+	oldPrint, oldSave := serverResponse, saveHeaders
+	serverResponse, saveHeaders = print, save
+	t.Cleanup(func() { serverResponse, saveHeaders = oldPrint, oldSave })
+}
+
+func TestServerResponsePrintsEveryHop(t *testing.T) {
+	server := hopServer()
+	defer server.Close()
+	setHeaderOptions(t, true, false)
+
+	r, w, _ := os.Pipe()
+	oldStderr := os.Stderr
+	os.Stderr = w
+	err := DownloadFile(server.URL+"/hop/1", filepath.Join(t.TempDir(), "file"), true, 0)
+	os.Stderr = oldStderr
+	w.Close()
+	if err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+
+	output := make([]byte, 64<<10)
+	n, _ := r.Read(output)
+	for _, want := range []string{
+		"  HTTP/1.1 302 Found\n",
+		"  Location: /hop/0\n",
+		"  HTTP/1.1 200 OK\n",
+		"  Content-Length: 7\n",
+	} {
+		if !strings.Contains(string(output[:n]), want) {
+			t.Errorf("output lacks %q:\n%s", want, output[:n])
+		}
+	}
+}
+
+func TestDownloadFileSaveHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cache", "HIT")
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+	setHeaderOptions(t, false, true)
+
+	target := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile(server.URL, target, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n") || !strings.Contains(got, "\r\nX-Cache: HIT\r\n") {
+		t.Errorf("file lacks the header block:\n%q", got)
+	}
+	if !strings.HasSuffix(got, "\r\n\r\nbody") {
+		t.Errorf("file does not end with the body after a blank line:\n%q", got)
+	}
+}
+
+func TestDownloadFileSaveHeadersToStdout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+	setHeaderOptions(t, false, true)
+
+	var err error
+	out := captureStdout(t, func() { err = DownloadFile(server.URL, "-", true, 0) })
+	if err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if got := string(out); !strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(got, "\r\n\r\nbody") {
+		t.Errorf("stdout = %q, want the header block then the body", got)
+	}
+}
@@ -0,0 +1,12 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// logf prints a status message. Status output goes to stderr so that
+// stdout carries nothing but file data when downloading with -O -.
+func logf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format, args...)
+}
@@ -1,27 +1,41 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"sync"
 )
 
 // MirrorWebsite initiates the website mirroring process. It creates a base directory
-// named after the website's domain and starts downloading the website content.
+// named after the website's domain, crawls the website from baseURL and then
+// converts the links in the saved pages and stylesheets.
 func MirrorWebsite(baseURL string, reject []string, exclude []string, convertLinks bool) error {
-	fmt.Printf("\n=== Starting mirror of %s ===\n", baseURL)
+	logf("\n=== Starting mirror of %s ===\n", baseURL)
+	trustHost(baseURL)
+	if spider {
+		// Links are only checked, so nothing is written
+		return crawl(baseURL, "", reject, exclude)
+	}
 	baseFolder, err := createDirectory(baseURL)
 	if err != nil {
 		return fmt.Errorf("error creating directory: %v", err)
 	}
-	fmt.Printf("Created directory: %s\n\n", baseFolder)
-	return downloadPage(baseURL, baseFolder, reject, exclude, convertLinks)
+	logf("Created directory: %s\n\n", baseFolder)
+
+	resetSavedFiles()
+	if err := crawl(baseURL, baseFolder, reject, exclude); err != nil {
+		return err
+	}
+	convertSavedFiles(baseFolder, convertLinks)
+	return nil
 }
 
 // createDirectory creates a directory named after the website's domain.
@@ -36,262 +50,260 @@ func createDirectory(baseURL string) (string, error) {
 	return domain, err
 }
 
-// downloadPage downloads a single webpage and its resources. It processes the HTML content,
-// downloads all associated resources, and updates links in the HTML if specified.
-// The page is saved maintaining the original URL path structure.
-func downloadPage(pageURL, baseFolder string, reject []string, exclude []string, convertLinks bool) error {
-	fmt.Printf("Downloading page: %s\n", pageURL)
-	resp, err := http.Get(pageURL)
-	if err != nil {
-		return err
+// downloadPage downloads a single webpage and its resources, and saves the page
+// maintaining the original URL path structure. Its links are converted once the
+// whole site is saved. It returns the pages on siteURL's host the page links to.
+// A link to something other than HTML is streamed to disk like any other file.
+func downloadPage(pageURL, siteURL, baseFolder string, reject []string, exclude []string) ([]string, error) {
+	if err := checkQuota(pageURL); err != nil {
+		return nil, err
+	}
+	release := acquireHost(pageURL)
+	if spider {
+		// Only pages are read for links; anything else just has to exist
+		contentType, err := checkURLType(pageURL)
+		if err != nil || !isHTMLType(contentType) {
+			release()
+			return nil, nil
+		}
+	} else if !looksLikeHTML(pageURL) {
+		release()
+		return nil, saveLinkedFile(pageURL, baseFolder, reject, exclude)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch page: %s", pageURL)
+	logf("Downloading page: %s\n", pageURL)
+	p, err := fetchPage(pageURL, true)
+	release()
+	if errors.Is(err, errNotHTML) {
+		return nil, saveLinkedFile(pageURL, baseFolder, reject, exclude)
 	}
-	fmt.Printf("Got response: %s for %s\n", resp.Status, pageURL)
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		if spider {
+			// Reported in the summary, like any other broken link
+			recordBroken(pageURL, err)
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	htmlContent := string(body)
-	resourceMap := downloadResources(htmlContent, pageURL, baseFolder, reject, exclude)
+	var links []string
+	htmlContent := string(p.body)
+	noindex, nofollow := metaRobots(htmlContent)
+	if !nofollow {
+		links = pageLinks(htmlContent, p.url, siteURL, reject, exclude)
+	}
+	if !noindex {
+		downloadResources(htmlContent, p.url, siteURL, baseFolder, reject, exclude)
+	}
+	if spider {
+		return links, nil
+	}
+	if noindex {
+		logf("Not saving %s: its robots meta tag says noindex\n", pageURL)
+		return links, nil
+	}
 
-	if convertLinks {
-		htmlContent = updateLinks(htmlContent, resourceMap)
-	} else {
-		htmlContent = updateCSSJSPaths(htmlContent, resourceMap)
+	relativePath, err := savePage(p, baseFolder)
+	if err != nil {
+		return nil, err
 	}
+	// Links may name the page as requested or where the redirects ended
+	recordSaved(pageURL, relativePath, "html")
+	recordSaved(p.url, relativePath, "html")
+	return links, nil
+}
 
+// savePage writes the body of p under baseFolder at the path of the page's
+// URL, and returns that path. An HTML page whose URL names a directory, or
+// has no extension, is saved as that directory's index.html.
+func savePage(p *page, baseFolder string) (string, error) {
 	// Get the URL path
-	parsedURL, err := url.Parse(pageURL)
+	parsedURL, err := url.Parse(p.url)
 	if err != nil {
-		return err
+		return "", err
 	}
-	// Determine the path for saving the HTML file
+	// Determine the path for saving the file
 	relativePath := strings.TrimPrefix(parsedURL.Path, "/")
-	fmt.Println("Relative path:", relativePath)
+	logf("Relative path: %s\n", relativePath)
 	if relativePath == "" {
 		relativePath = "index.html"
-	} else if !strings.Contains(relativePath, ".") {
-		fmt.Println("No extension found, checking if content is HTML")
-		// Create a temporary file to check if content is HTML
-		tempPath := filepath.Join(baseFolder, relativePath)
-		if err := os.MkdirAll(tempPath, 0755); err != nil {
-			return fmt.Errorf("failed to create temp directory: %v", err)
-		}
-		
-		tempFile := filepath.Join(tempPath, "temp")
-		if err := os.WriteFile(tempFile, []byte(htmlContent), 0644); err != nil {
-			return fmt.Errorf("failed to write temp file: %v", err)
-		}
-		
-		// Check if the content is HTML
-		if isHTMLFile(tempFile) {
-			relativePath = filepath.Join(relativePath, "index.html")
-			fmt.Printf("Detected HTML content, using path: %s\n", relativePath)
-		}
-		
-		// Clean up temp file
-		os.Remove(tempFile)
+	} else if isHTMLType(p.contentType) && (strings.HasSuffix(relativePath, "/") || !strings.Contains(path.Base(relativePath), ".")) {
+		relativePath = filepath.Join(relativePath, "index.html")
+		logf("Detected HTML content, using path: %s\n", relativePath)
+	}
+	if err := checkLocalPath(relativePath); err != nil {
+		return "", err
 	}
 
 	// Create all necessary directories
 	dir := filepath.Join(baseFolder, filepath.Dir(relativePath))
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directories: %v", err)
+		return "", fmt.Errorf("failed to create directories: %v", err)
 	}
 
-	// Save the HTML file
-	htmlPath := filepath.Join(baseFolder, relativePath)
-	fmt.Printf("Saving HTML to: %s\n", filepath.Join(baseFolder, relativePath))
-	return os.WriteFile(htmlPath, []byte(htmlContent), 0644)
+	// Save the file
+	savePath := filepath.Join(baseFolder, relativePath)
+	logf("Saving page to: %s\n", savePath)
+	quotaUsed.Add(int64(len(p.body)))
+	return relativePath, os.WriteFile(savePath, p.body, 0644)
 }
 
-// updateCSSJSPaths modifies CSS and JavaScript file paths in HTML content to use relative paths.
-// It updates both src and href attributes to point to the locally downloaded files.
-func updateCSSJSPaths(htmlContent string, resourceMap map[string]string) string {
-	for originalURL, filename := range resourceMap {
-		if strings.HasSuffix(strings.ToLower(originalURL), ".css") || strings.HasSuffix(strings.ToLower(originalURL), ".js") {
-			// Handle src attribute with both quote types
-			htmlContent = strings.ReplaceAll(htmlContent,
-				fmt.Sprintf(`src="%s"`, originalURL),
-				fmt.Sprintf(`src="./%s"`, filename))
-			htmlContent = strings.ReplaceAll(htmlContent,
-				fmt.Sprintf(`src='%s'`, originalURL),
-				fmt.Sprintf(`src='./%s'`, filename))
-			
-			// Handle href attribute for CSS files with both quote types
-			htmlContent = strings.ReplaceAll(htmlContent,
-				fmt.Sprintf(`href="%s"`, originalURL),
-				fmt.Sprintf(`href="./%s"`, filename))
-			htmlContent = strings.ReplaceAll(htmlContent,
-				fmt.Sprintf(`href='%s'`, originalURL),
-				fmt.Sprintf(`href='./%s'`, filename))
-		}
+// checkLocalPath rejects a path taken from a URL that would leave the
+// mirror's folder once cleaned, as "/%2e%2e/" decodes to "../".
+func checkLocalPath(relativePath string) error {
+	if !filepath.IsLocal(filepath.FromSlash(relativePath)) {
+		return fmt.Errorf("refusing to save outside the mirror: %s", relativePath)
 	}
-	return htmlContent
+	return nil
 }
-//bool to check whether to add .html to files that don't have an extension and are html files if we look at the content
-func isHTMLFile(path string) bool {
-	content, err := os.ReadFile(path)
+
+// looksLikeHTML guesses from its extension whether urlStr is a page. An
+// unknown or missing extension may well be one.
+func looksLikeHTML(urlStr string) bool {
+	u, err := url.Parse(urlStr)
 	if err != nil {
-		return false
+		return true
 	}
-	return strings.Contains(string(content), "<html") || strings.Contains(string(content), "<!DOCTYPE html")
+	return isHTMLType(mime.TypeByExtension(path.Ext(u.Path)))
 }
 
+// saveLinkedFile saves a link that is not a page like any other file,
+// streamed to disk by downloadFile rather than read into memory.
+func saveLinkedFile(fileURL, baseFolder string, reject []string, exclude []string) error {
+	_, err := downloadFile(fileURL, baseFolder, reject, exclude)
+	if errors.Is(err, errAlreadyFetched) {
+		return nil
+	}
+	return err
+}
 
-// updateLinks modifies all resource links in HTML content to use relative paths.
-// This includes images, stylesheets, scripts, and other embedded resources.
-func updateLinks(htmlContent string, resourceMap map[string]string) string {
-	for originalURL, filename := range resourceMap {
-		htmlContent = strings.ReplaceAll(htmlContent,
-			fmt.Sprintf(`src="%s"`, originalURL),
-			fmt.Sprintf(`src="./%s"`, filename))
-		htmlContent = strings.ReplaceAll(htmlContent,
-			fmt.Sprintf(`href="%s"`, originalURL),
-			fmt.Sprintf(`href="./%s"`, filename))
-		htmlContent = strings.ReplaceAll(htmlContent,
-			fmt.Sprintf(`url(%s)`, originalURL),
-			fmt.Sprintf(`url("./%s")`, filename))
-		htmlContent = strings.ReplaceAll(htmlContent,
-			fmt.Sprintf(`url('%s')`, originalURL),
-			fmt.Sprintf(`url('./%s')`, filename))
-		htmlContent = strings.ReplaceAll(htmlContent,
-			fmt.Sprintf(`url("%s")`, originalURL),
-			fmt.Sprintf(`url("./%s")`, filename))
-	}
-	return htmlContent
+// page is a document fetched whole by the mirror.
+type page struct {
+	url         string // where it was served from, which differs after a redirect
+	contentType string
+	body        []byte
 }
 
-// downloadResources scans HTML content for resources (images, scripts, stylesheets, etc.)
-// and downloads them concurrently. It maintains a map of original URLs to local file paths.
-// Uses a semaphore to limit concurrent downloads.
-func downloadResources(htmlContent, pageURL, baseFolder string, reject []string, exclude []string) map[string]string {
-	fmt.Printf("\nScanning for resources in: %s\n", pageURL)
-	resourceMap := make(map[string]string)
-	var mutex sync.Mutex
-	var wg sync.WaitGroup
+// errNotHTML is returned by fetchPage for a page that turns out to be some
+// other kind of file.
+var errNotHTML = errors.New("not an HTML page")
+
+// fetchPage downloads the page at pageURL into memory. Links on the page
+// are relative to the URL it was served from, which it records. A redirect
+// to another host is refused, as the mirror keeps to one site. With
+// htmlOnly, any other kind of file is left unread and errNotHTML returned.
+func fetchPage(pageURL string, htmlOnly bool) (*page, error) {
+	p := &page{url: pageURL}
+	err := withRetry(pageURL, func() error {
+		req, err := newRequest(pageURL)
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
 
-	semaphore := make(chan struct{}, 5)
+		if final := finalURL(resp, pageURL); !isSameDomain(pageURL, final) {
+			return fmt.Errorf("redirected to another host: %s", final)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to fetch page: %s: %w", pageURL, newStatusError(resp))
+		}
+		p.url = finalURL(resp, pageURL)
+		p.contentType = resp.Header.Get("Content-Type")
+		logf("Got response: %s for %s\n", resp.Status, p.url)
+		if htmlOnly && !isHTMLType(p.contentType) {
+			return errNotHTML
+		}
 
-	patterns := []*regexp.Regexp{
-		regexp.MustCompile(`src=['"]([^'"]*?)['"]`),                              // src with both quote types
-		regexp.MustCompile(`href=['"]([^'"]*?)['"]`),                             // href with both quote types
-		regexp.MustCompile(`url\(['"]?([^'"()]+)['"]?\)`),                        // CSS url()
-		regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`),                         // CSS @import
-		regexp.MustCompile(`<script[^>]+src=['"]([^'"]+)['"]`),                   // script tags
-		regexp.MustCompile(`<link[^>]+href=['"]([^'"]+)['"]`),                    // link tags
-		regexp.MustCompile(`<img[^>]+src=['"]([^'"]+)['"]`),                      // img tags
-		regexp.MustCompile(`content=['"]([^'"]+\.(?:png|jpg|jpeg|gif|ico))['"]`), // meta images
-	}
-
-	processedURLs := make(map[string]bool)
-	for _, pattern := range patterns {
-		matches := pattern.FindAllStringSubmatch(htmlContent, -1)
-		for _, match := range matches {
-			if len(match) < 2 {
-				continue
-			}
-			resourceURL := match[1]
+		p.body, err = io.ReadAll(resp.Body)
+		return err
+	})
+	return p, err
+}
 
-			if processedURLs[resourceURL] {
-				continue
-			}
-			processedURLs[resourceURL] = true
+// isHTMLType reports whether a Content-Type header names an HTML page. A
+// missing header is taken to be one.
+func isHTMLType(contentType string) bool {
+	return contentType == "" || strings.Contains(strings.ToLower(contentType), "html")
+}
 
-			if shouldSkipResource(resourceURL) {
-				continue
-			}
+// downloadResources scans HTML content for resources (images, scripts, stylesheets, etc.)
+// and downloads them concurrently, along with the resources the stylesheets refer to.
+// Only resources on siteURL's host are fetched. Uses a semaphore to limit
+// concurrent downloads; --wait and --max-per-host further pace them through
+// the host's queue in downloadFile.
+func downloadResources(htmlContent, pageURL, siteURL, baseFolder string, reject []string, exclude []string) {
+	logf("\nScanning for resources in: %s\n", pageURL)
+	var wg sync.WaitGroup
 
-			absoluteURL := resolveURL(pageURL, resourceURL)
-			if absoluteURL == "" || !isSameDomain(pageURL, absoluteURL) {
-				continue
-			}
+	semaphore := make(chan struct{}, 5)
 
-			wg.Add(1)
-			go func(absURL, resURL string) {
-				defer wg.Done()
-				semaphore <- struct{}{}
-				defer func() { <-semaphore }()
-
-				if filename, err := downloadFile(absURL, baseFolder, reject, exclude); err == nil {
-					mutex.Lock()
-					resourceMap[resURL] = filename
-					mutex.Unlock()
-
-					if strings.HasSuffix(strings.ToLower(filename), ".css") {
-						if cssContent, err := os.ReadFile(filepath.Join(baseFolder, filename)); err == nil {
-							cssResources := downloadCSSResources(string(cssContent), absURL, baseFolder, reject, exclude)
-							mutex.Lock()
-							for k, v := range cssResources {
-								resourceMap[k] = v
-							}
-							mutex.Unlock()
-						}
-					}
-				}
-			}(absoluteURL, resourceURL)
+	// Links to other pages are left to the crawler
+	for _, link := range extractLinks(htmlContent, pageURL) {
+		if link.page || shouldSkipResource(link.raw) || !isSameDomain(siteURL, link.absolute) {
+			continue
 		}
+		wg.Add(1)
+		go func(absURL string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			filename, err := downloadFile(absURL, baseFolder, reject, exclude)
+			if err != nil {
+				return
+			}
+			if spider && strings.HasSuffix(strings.ToLower(absURL), ".css") {
+				// Nothing was saved, so read the stylesheet for its links
+				release := acquireHost(absURL)
+				css, err := fetchPage(absURL, false)
+				release()
+				if err == nil {
+					downloadCSSResources(string(css.body), css.url, baseFolder, reject, exclude)
+				}
+			} else if strings.HasSuffix(strings.ToLower(filename), ".css") {
+				if cssContent, err := os.ReadFile(filepath.Join(baseFolder, filename)); err == nil {
+					downloadCSSResources(string(cssContent), absURL, baseFolder, reject, exclude)
+				}
+			}
+		}(link.absolute)
 	}
 
 	wg.Wait()
-	return resourceMap
 }
 
 // downloadCSSResources scans CSS content for referenced resources (like images and fonts)
 // and downloads them concurrently. Similar to downloadResources but specific to CSS files.
-func downloadCSSResources(cssContent, baseURL, baseFolder string, reject []string, exclude []string) map[string]string {
-	fmt.Printf("Scanning CSS for resources from: %s\n", baseURL)
-	resourceMap := make(map[string]string)
-	var mutex sync.Mutex
+func downloadCSSResources(cssContent, baseURL, baseFolder string, reject []string, exclude []string) {
+	logf("Scanning CSS for resources from: %s\n", baseURL)
 	var wg sync.WaitGroup
 
-	patterns := []*regexp.Regexp{
-		regexp.MustCompile(`url\(['"]?([^'"()]+)['"]?\)`),
-		regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`),
-	}
-
 	semaphore := make(chan struct{}, 5)
 
-	for _, pattern := range patterns {
-		matches := pattern.FindAllStringSubmatch(cssContent, -1)
-		for _, match := range matches {
-			if len(match) < 2 {
-				continue
-			}
-			resourceURL := match[1]
-
-			if shouldSkipResource(resourceURL) {
-				continue
-			}
+	for _, resourceURL := range cssLinks(cssContent) {
+		if shouldSkipResource(resourceURL) {
+			continue
+		}
 
-			absoluteURL := resolveURL(baseURL, resourceURL)
-			if absoluteURL == "" || !isSameDomain(baseURL, absoluteURL) {
-				continue
-			}
+		absoluteURL := resolveURL(baseURL, resourceURL)
+		if absoluteURL == "" || !isSameDomain(baseURL, absoluteURL) {
+			continue
+		}
 
-			wg.Add(1)
-			go func(absURL, resURL string) {
-				defer wg.Done()
-				semaphore <- struct{}{}
-				defer func() { <-semaphore }()
+		wg.Add(1)
+		go func(absURL string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
 
-				if filename, err := downloadFile(absURL, baseFolder, reject, exclude); err == nil {
-					mutex.Lock()
-					resourceMap[resURL] = filename
-					mutex.Unlock()
-				}
-			}(absoluteURL, resourceURL)
-		}
+			downloadFile(absURL, baseFolder, reject, exclude)
+		}(absoluteURL)
 	}
 
 	wg.Wait()
-	return resourceMap
 }
 
 // shouldSkipResource checks if a resource URL should be skipped based on its scheme
@@ -311,17 +323,26 @@ func shouldSkipResource(resourceURL string) bool {
 // Returns the relative path to the downloaded file or an error.
 func downloadFile(fileURL, baseFolder string, reject []string, exclude []string) (string, error) {
 	if !shouldDownloadFile(fileURL, reject, exclude) {
-		fmt.Printf("Skipping filtered file: %s\n", fileURL)
+		logf("Skipping filtered file: %s\n", fileURL)
 		return "", fmt.Errorf("file filtered out: %s", fileURL)
 	}
+	if !robotsAllowed(fileURL) {
+		logf("Skipping %s: disallowed by robots.txt\n", fileURL)
+		return "", fmt.Errorf("disallowed by robots.txt: %s", fileURL)
+	}
+	if !claimRequisite(fileURL) {
+		// Shared by an earlier page
+		return "", errAlreadyFetched
+	}
 
-	fmt.Printf("Downloading resource: %s\n", fileURL)
-	resp, err := http.Get(fileURL)
-	if err != nil {
-		fmt.Printf("Error downloading %s: %v\n", fileURL, err)
+	release := acquireHost(fileURL)
+	defer release()
+	if spider {
+		return "", checkURL(fileURL)
+	}
+	if err := checkQuota(fileURL); err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
 	u, err := url.Parse(fileURL)
 	if err != nil {
@@ -333,6 +354,9 @@ func downloadFile(fileURL, baseFolder string, reject []string, exclude []string)
 	if relativePath == "" {
 		return "", fmt.Errorf("empty path")
 	}
+	if err := checkLocalPath(relativePath); err != nil {
+		return "", err
+	}
 
 	// Create the full path including folders
 	fullPath := filepath.Join(baseFolder, relativePath)
@@ -343,20 +367,81 @@ func downloadFile(fileURL, baseFolder string, reject []string, exclude []string)
 		return "", fmt.Errorf("failed to create directories: %v", err)
 	}
 
-	// Create and write to the file
-	out, err := os.Create(fullPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %v", err)
-	}
-	defer out.Close()
+	logf("Downloading resource: %s\n", fileURL)
+	var written int64 // saved by earlier attempts; a retry asks for the rest
+	err = withRetry(fileURL, func() error {
+		req, err := newRequest(fileURL)
+		if err != nil {
+			return err
+		}
+		if written > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", written))
+		} else if timestamping {
+			addConditions(req, fullPath)
+		}
+
+		resp, err := httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if final := finalURL(resp, fileURL); !isSameDomain(fileURL, final) {
+			return fmt.Errorf("redirected to another host: %s", final)
+		}
+		if timestamping && written == 0 && (resp.StatusCode == http.StatusNotModified ||
+			resp.StatusCode == http.StatusOK && !remoteIsNewer(resp, fullPath)) {
+			logf("Not modified, keeping: %s\n", fullPath)
+			return nil
+		}
+
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		switch {
+		case written > 0 && resp.StatusCode == http.StatusPartialContent:
+			if start, _, _, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil || start != written {
+				// Start over on the next attempt
+				written = 0
+				return fmt.Errorf("unexpected range from server: %w", io.ErrUnexpectedEOF)
+			}
+			flags = os.O_WRONLY | os.O_APPEND
+			logf("resuming %s from byte %d\n", fileURL, written)
+		case resp.StatusCode == http.StatusOK:
+			// A server that ignores the range sends the whole file again
+			written = 0
+		default:
+			return newStatusError(resp)
+		}
 
-	_, err = io.Copy(out, resp.Body)
+		// Create and write to the file
+		out, err := os.OpenFile(fullPath, flags, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer out.Close()
+
+		n, err := io.Copy(io.MultiWriter(out, &quotaWriter{url: fileURL}), resp.Body)
+		written += n
+		if err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		if timestamping {
+			saveTimestamp(fullPath, resp.Header)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to write file: %v", err)
+		logf("Error downloading %s: %v\n", fileURL, err)
+		return "", err
 	}
 
 	// After successful download
-	fmt.Printf("Successfully downloaded: %s -> %s/%s\n", fileURL, baseFolder, relativePath)
+	logf("Successfully downloaded: %s -> %s/%s\n", fileURL, baseFolder, relativePath)
+	kind := ""
+	if strings.EqualFold(path.Ext(relativePath), ".css") {
+		// Stylesheets have their url() links converted with the pages
+		kind = "css"
+	}
+	recordSaved(fileURL, relativePath, kind)
 	return relativePath, nil
 }
 
@@ -390,28 +475,17 @@ func shouldDownloadFile(fileURL string, reject []string, exclude []string) bool
 	return true
 }
 
-// resolveURL converts a relative URL to an absolute URL using the base URL.
-// Handles both absolute URLs and relative URLs (with or without leading slash).
+// resolveURL converts a relative URL to an absolute URL using the base URL,
+// as a browser would. It returns "" if either cannot be parsed.
 func resolveURL(baseURL, resourcePath string) string {
-	if strings.HasPrefix(resourcePath, "http://") || strings.HasPrefix(resourcePath, "https://") {
-		return resourcePath
-	}
-
 	base, err := url.Parse(baseURL)
 	if err != nil {
 		return ""
 	}
-
-	if strings.HasPrefix(resourcePath, "/") {
-		base.Path = resourcePath
-		return base.String()
-	}
-
 	rel, err := url.Parse(resourcePath)
 	if err != nil {
 		return ""
 	}
-
 	return base.ResolveReference(rel).String()
 }
 
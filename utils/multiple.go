@@ -3,14 +3,16 @@ package utils
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
-// function to read urls from a file
+// function to read urls from a file, one per line, each optionally
+// followed by the checksum the download must match
 func ReadUrlsFromFile(filePath string) ([]string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -21,13 +23,25 @@ func ReadUrlsFromFile(filePath string) ([]string, error) {
 	scanner := bufio.NewScanner(file)
 	var urls []string
 	for scanner.Scan() {
-		urls = append(urls, scanner.Text())
+		// A line may follow the URL with its expected digest: "URL sha256:..."
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 1 {
+			sum, err := parseChecksum(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("checksum for %s: %v", fields[0], err)
+			}
+			setListChecksum(fields[0], sum)
+		}
+		urls = append(urls, fields[0])
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
-	fmt.Println(urls)
+	logf("%v\n", urls)
 	return urls, nil
 }
 
@@ -35,48 +49,96 @@ func DownloadFilesConcurrently(urls []string, outputPrefix string, background bo
 	var wg sync.WaitGroup
 	errorChan := make(chan error, len(urls))
 
+	// With -O -, the bodies are written to stdout one after another, in
+	// list order, so the downloads cannot run side by side.
+	toStdout := outputPrefix == "-"
+
 	// If rate limit is specified, divide it among concurrent downloads
-	var perFileRateLimit int64
-	if rateLimit > 0 {
+	perFileRateLimit := rateLimit
+	if rateLimit > 0 && !toStdout {
 		perFileRateLimit = rateLimit / int64(len(urls))
-		fmt.Printf("Rate limit per file: %.2f KB/s\n", float64(perFileRateLimit)/1024)
+		logf("Rate limit per file: %.2f KB/s\n", float64(perFileRateLimit)/1024)
 	}
 
 	// Print total content size
 	sizes := make([]int64, len(urls))
 	for i, url := range urls {
-		resp, err := http.Get(url)
+		trustHost(url)
+		if spider {
+			// --spider checks each URL itself, without fetching bodies
+			continue
+		}
+		err := withRetry(url, func() error {
+			// A bodiless GET, so a --method or --post-data request is
+			// only ever sent once, by the download itself
+			req, err := newGetRequest(url)
+			if err != nil {
+				return err
+			}
+			resp, err := httpClient().Do(req)
+			if err != nil {
+				return err
+			}
+			sizes[i] = resp.ContentLength
+			resp.Body.Close()
+			return nil
+		})
 		if err != nil {
 			return fmt.Errorf("error getting content size: %v", err)
 		}
-		sizes[i] = resp.ContentLength
-		resp.Body.Close()
 	}
-	fmt.Printf("Content size: %v\n", sizes)
+	if !spider {
+		logf("Content size: %v\n", sizes)
+	}
 
-	for i, url := range urls {
-		wg.Add(1)
-		go func(url string, index int) {
-			defer wg.Done()
+	download := func(url string, index int) {
+		// Without a prefix, the name is chosen from the URL or the server's response
+		filename := DirTarget(path)
+		if toStdout {
+			filename = "-"
+		} else if outputPrefix != "" {
+			filename = filepath.Join(path, fmt.Sprintf("%s_%d", outputPrefix, index))
+		}
 
-			var filename string
-			if outputPrefix != "" {
-				filename = fmt.Sprintf("%s_%d", outputPrefix, index)
-			} else {
-				filename = GetFileName(url)
-			}
+		err := DownloadFile(url, filename, background, perFileRateLimit)
+		if errors.Is(err, errQuotaExceeded) {
+			// Listed in the quota summary rather than counted as a failure
+			return
+		}
+		if err != nil {
+			errorChan <- fmt.Errorf("error downloading %s: %v", url, err)
+			return
+		}
+		logf("Finished %s\n", url)
+	}
 
-			// Combine path with filename if path is specified
-			if path != "" {
-				filename = filepath.Join(path, filename)
+	// The transfers run side by side, so none of them would see the others'
+	// bytes when checking the quota. It is checked here instead, in list
+	// order, counting the size of the transfers already started.
+	planned := quotaUsed.Load()
+	resync := false
+	for i, url := range urls {
+		if toStdout {
+			download(url, i)
+			continue
+		}
+		if quota > 0 {
+			if sizes[i] < 0 || resync {
+				// Without a size, only finished transfers tell what was used
+				wg.Wait()
+				planned = quotaUsed.Load()
 			}
-
-			err := DownloadFile(url, filename, background, perFileRateLimit)
-			if err != nil {
-				errorChan <- fmt.Errorf("error downloading %s: %v", url, err)
-				return
+			if planned >= quota {
+				skipForQuota(url)
+				continue
 			}
-			fmt.Printf("Finished %s\n", filename)
+			resync = sizes[i] < 0
+			planned += max(sizes[i], 0)
+		}
+		wg.Add(1)
+		go func(url string, index int) {
+			defer wg.Done()
+			download(url, index)
 		}(url, i)
 	}
 
@@ -90,13 +152,13 @@ func DownloadFilesConcurrently(urls []string, outputPrefix string, background bo
 	var errCount int
 	for err := range errorChan {
 		errCount++
-		fmt.Println(err)
+		logf("%v\n", err)
 	}
 
 	if errCount > 0 {
 		return fmt.Errorf("%d downloads failed", errCount)
 	}
 
-	fmt.Printf("\nDownload finished: %v\n", urls)
+	logf("\nDownload finished: %v\n", urls)
 	return nil
 }
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	netrcOnce    sync.Once
+	netrcEntries []netrcEntry
+)
+
+// netrcEntry is a machine (or, with an empty machine, the default) entry
+// of a .netrc file.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// netrcLookup returns the ~/.netrc entry for host, falling back to the
+// default entry. $NETRC names a different file.
+func netrcLookup(host string) *netrcEntry {
+	netrcOnce.Do(func() {
+		path := os.Getenv("NETRC")
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return
+			}
+			path = filepath.Join(home, ".netrc")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		netrcEntries = parseNetrc(string(data))
+	})
+
+	var fallback *netrcEntry
+	for i := range netrcEntries {
+		e := &netrcEntries[i]
+		if e.machine == "" && fallback == nil {
+			fallback = e
+		} else if strings.EqualFold(e.machine, host) {
+			return e
+		}
+	}
+	return fallback
+}
+
+// parseNetrc reads the machine, default, login and password tokens of a
+// .netrc file. Macro definitions are skipped.
+func parseNetrc(data string) []netrcEntry {
+	var entries []netrcEntry
+	current := -1 // index of the entry being read
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for k := 0; k < len(fields); k++ {
+			next := func() string {
+				if k+1 < len(fields) {
+					k++
+					return fields[k]
+				}
+				return ""
+			}
+			switch fields[k] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: next()})
+				current = len(entries) - 1
+			case "default":
+				entries = append(entries, netrcEntry{})
+				current = len(entries) - 1
+			case "login":
+				if login := next(); current >= 0 {
+					entries[current].login = login
+				}
+			case "password":
+				if password := next(); current >= 0 {
+					entries[current].password = password
+				}
+			case "account":
+				next()
+			case "macdef":
+				// The macro runs until the next blank line
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				k = len(fields)
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// partName is the temporary file a download is written to. It lives next
+// to the final file so that the closing rename stays on one filesystem.
+func partName(fileName string) string {
+	return fileName + ".part"
+}
+
+// commitPart finishes the .part file out of fileName: it checks that the
+// size matches want (skipped when want is -1), flushes the data to disk and
+// renames the file into place. Until then fileName is left untouched, so a
+// killed download never looks complete. With exclusive, see placePart.
+func commitPart(out *os.File, fileName string, want int64, exclusive bool) error {
+	info, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	if want >= 0 && info.Size() != want {
+		return fmt.Errorf("got %d of %d bytes: %w", info.Size(), want, io.ErrUnexpectedEOF)
+	}
+
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return placePart(fileName, exclusive)
+}
+
+// placePart renames the .part file of fileName into place. With exclusive
+// an existing fileName is never replaced, even one that appeared while the
+// download ran; the .part file is then kept and an error returned.
+func placePart(fileName string, exclusive bool) error {
+	if exclusive {
+		// Claim the name atomically, then replace only our own empty file
+		f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s appeared during the download, which is kept in %s: %w", fileName, partName(fileName), errFileExists)
+		}
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	return os.Rename(partName(fileName), fileName)
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadFileFailureKeepsPart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("only part of it"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := DownloadFile(server.URL+"/file.txt", DirTarget(dir), true, 0); err == nil {
+		t.Fatal("expected an error for a truncated body")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "file.txt")); err == nil {
+		t.Error("a truncated download was saved under its final name")
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "file.txt.part")); string(got) != "only part of it" {
+		t.Errorf("file.txt.part has %q; want the bytes received so far", got)
+	}
+}
+
+func TestDownloadFileContinueFromPart(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	continueDownload = true
+	defer func() { continueDownload = false }()
+
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(partName(fileName), content[:300], 0644); err != nil {
+		t.Fatalf("failed to write part file: %v", err)
+	}
+
+	if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(fileName); !bytes.Equal(got, content) {
+		t.Errorf("downloaded file has %d bytes, want %d matching bytes", len(got), len(content))
+	}
+	if _, err := os.Stat(partName(fileName)); err == nil {
+		t.Error("part file was left behind after a complete download")
+	}
+}
+
+func TestCommitPart(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "file.txt")
+
+	out, err := os.Create(partName(fileName))
+	if err != nil {
+		t.Fatalf("failed to create part file: %v", err)
+	}
+	out.Write([]byte("12345"))
+
+	if err := commitPart(out, fileName, 10, false); err == nil {
+		t.Error("expected an error when the size does not match Content-Length")
+	}
+	if _, err := os.Stat(fileName); err == nil {
+		t.Error("a short file was renamed into place")
+	}
+
+	if err := commitPart(out, fileName, 5, false); err != nil {
+		t.Fatalf("commitPart failed: %v", err)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "12345" {
+		t.Errorf("committed file has %q; want %q", got, "12345")
+	}
+}
+
+func TestCommitPartExclusive(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "file.txt")
+
+	out, err := os.Create(partName(fileName))
+	if err != nil {
+		t.Fatalf("failed to create part file: %v", err)
+	}
+	out.Write([]byte("12345"))
+
+	// Someone else saves a file under the name while we download
+	if err := os.WriteFile(fileName, []byte("theirs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := commitPart(out, fileName, 5, true); !errors.Is(err, errFileExists) {
+		t.Errorf("commitPart = %v; want errFileExists", err)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "theirs" {
+		t.Errorf("existing file was overwritten with %q", got)
+	}
+	if got, _ := os.ReadFile(partName(fileName)); string(got) != "12345" {
+		t.Errorf("part file has %q; want it kept", got)
+	}
+}
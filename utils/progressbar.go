@@ -1,21 +1,33 @@
 package utils
 
 import (
-	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
-
 type ProgressBar struct {
 	Total     int64
 	Written   int64
 	StartTime time.Time
 	BarLength int
+	// Offset is the number of bytes that were already on disk when the
+	// download (re)started; they count towards progress but not speed.
+	Offset int64
+	// Wire, when set, counts the bytes received for a compressed body.
+	// Total and the speed then refer to those bytes, while Written counts
+	// the decoded ones.
+	Wire func() int64
+
+	mu sync.Mutex // serialises writes from concurrent segments
 }
 
-// an io writer 
+// an io writer
 func (pb *ProgressBar) Write(p []byte) (int, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
 	n := len(p)
 	pb.Written += int64(n)
 	pb.printProgress()
@@ -27,6 +39,12 @@ func (pb *ProgressBar) StartTimer() {
 	pb.StartTime = time.Now()
 }
 
+// resume the bar from bytes already downloaded by an earlier attempt
+func (pb *ProgressBar) StartFrom(offset int64) {
+	pb.Offset = offset
+	pb.Written = offset
+}
+
 // total time taken for the download.
 func (pb *ProgressBar) EndTimer() time.Duration {
 	return time.Since(pb.StartTime)
@@ -38,21 +56,39 @@ func (pb *ProgressBar) CalculateSpeed() float64 {
 	if duration == 0 {
 		return 0
 	}
-	return float64(pb.Written) / duration
+	return float64(pb.received()-pb.Offset) / duration
+}
+
+// received is the byte count measured against Total.
+func (pb *ProgressBar) received() int64 {
+	if pb.Wire != nil {
+		return pb.Wire()
+	}
+	return pb.Written
 }
 
 // display the progress bar, percentage, and speed.
 func (pb *ProgressBar) printProgress() {
-	since:=pb.EndTimer()
-	downloaded:=float64(pb.Written)/1000
-	total:=float64(pb.Total)/1000
-	percent := float64(pb.Written) / float64(pb.Total) * 100
-	filledLength := int(percent) * pb.BarLength / 100
+	since := pb.EndTimer()
+	downloaded := float64(pb.Written) / 1000
+	speed := pb.CalculateSpeed() / 1000 / 1000
+	// Without a known size there is nothing to draw a bar against
+	if pb.Total <= 0 {
+		logf("\r %.2f KiB | %.2f MB/s %.0fs", downloaded, speed, since.Seconds())
+		return
+	}
+	total := float64(pb.Total) / 1000
+	percent := float64(pb.received()) / float64(pb.Total) * 100
+	filledLength := min(int(percent)*pb.BarLength/100, pb.BarLength)
 	bar := strings.Repeat("=", filledLength) + strings.Repeat(" ", pb.BarLength-filledLength)
-	speed := pb.CalculateSpeed()/1000/1000
-	fmt.Printf("\r %.2f KiB / %.2f KiB [%s] %.2f%% | %.2f MB/s %.0fs", downloaded,total,bar, percent, speed, since.Seconds())
+	if pb.Wire != nil {
+		wire := float64(pb.Wire()) / 1000
+		logf("\r %.2f KiB (%.2f KiB / %.2f KiB compressed) [%s] %.2f%% | %.2f MB/s %.0fs", downloaded, wire, total, bar, percent, speed, since.Seconds())
+		return
+	}
+	logf("\r %.2f KiB / %.2f KiB [%s] %.2f%% | %.2f MB/s %.0fs", downloaded, total, bar, percent, speed, since.Seconds())
 	if pb.Written == pb.Total {
-		fmt.Print("\n\n")
+		logf("\n\n")
 	}
 }
 
@@ -63,3 +99,19 @@ func NewProgressBar(total int64, barLength int) *ProgressBar {
 		BarLength: barLength,
 	}
 }
+
+// newProgress returns the writer tracking the download of body: a progress
+// bar, or io.Discard in the background. total includes the offset bytes
+// already on disk. The bar of a decoded body follows the compressed bytes.
+func newProgress(body io.Reader, total, offset int64, background bool) io.Writer {
+	if background {
+		return io.Discard
+	}
+	bar := NewProgressBar(total, 50)
+	if decoded, ok := body.(*decodedBody); ok {
+		bar.Total, bar.Wire = decoded.wireLength, decoded.WireBytes
+	}
+	bar.StartFrom(offset)
+	bar.StartTimer()
+	return bar
+}
@@ -65,3 +65,36 @@ func TestProgressBar_CalculateSpeed(t *testing.T) {
 		t.Errorf("expected speed to be greater than 0, got %f", speed)
 	}
 }
+
+func TestProgressBar_StartFrom(t *testing.T) {
+	pb := NewProgressBar(1000, 20)
+	pb.StartFrom(400)
+	pb.StartTimer()
+
+	pb.Write(bytes.Repeat([]byte("x"), 100))
+
+	if pb.Written != 500 {
+		t.Errorf("expected 500 bytes written, got %d", pb.Written)
+	}
+	if pb.Offset != 400 {
+		t.Errorf("expected offset 400, got %d", pb.Offset)
+	}
+}
+
+func TestProgressBar_Wire(t *testing.T) {
+	wire := int64(0)
+	pb := NewProgressBar(200, 20)
+	pb.Wire = func() int64 { return wire }
+	pb.StartTimer()
+
+	// 1000 decoded bytes from 100 compressed ones
+	wire = 100
+	pb.Write(bytes.Repeat([]byte("x"), 1000))
+
+	if pb.Written != 1000 {
+		t.Errorf("expected 1000 decoded bytes written, got %d", pb.Written)
+	}
+	if got := pb.received(); got != 100 {
+		t.Errorf("expected progress measured in 100 wire bytes, got %d", got)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Proxy settings, set by --proxy, --no-proxy, --proxy-user and
+// --proxy-password. Without --proxy the http_proxy, https_proxy and
+// no_proxy environment variables apply.
+var (
+	proxyURL      string
+	noProxy       bool
+	proxyUser     string
+	proxyPassword string
+)
+
+// proxyFunc picks the proxy for each request, or returns nil when requests
+// go direct. Proxies may be http://, https:// or socks5:// URLs, optionally
+// with credentials, which --proxy-user and --proxy-password override.
+func proxyFunc() func(*http.Request) (*url.URL, error) {
+	if noProxy {
+		return nil
+	}
+
+	config := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		config.HTTPProxy, config.HTTPSProxy = proxyURL, proxyURL
+	}
+	choose := config.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxy, err := choose(req.URL)
+		if err != nil || proxy == nil {
+			return proxy, err
+		}
+		if proxyUser != "" {
+			proxy.User = url.UserPassword(proxyUser, proxyPassword)
+		}
+		return proxy, nil
+	}
+}
+
+// parseProxyURL checks a --proxy value. A bare "host:port" means an HTTP
+// proxy.
+func parseProxyURL(value string) (string, error) {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid proxy %q", value)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return value, nil
+	}
+	return "", fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", u.Scheme)
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// setProxy sets --proxy and the proxy credentials for a test and gives it
+// a fresh client.
+func setProxy(t *testing.T, proxy, user, password string) {
+	oldProxy, oldNoProxy, oldUser, oldPassword := proxyURL, noProxy, proxyUser, proxyPassword
+	proxyURL, proxyUser, proxyPassword = proxy, user, password
+	resetHTTPClient()
+	t.Cleanup(func() {
+		proxyURL, noProxy, proxyUser, proxyPassword = oldProxy, oldNoProxy, oldUser, oldPassword
+		resetHTTPClient()
+	})
+}
+
+func TestParseProxyURL(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"proxy.local:3128", "http://proxy.local:3128", false},
+		{"https://proxy.local", "https://proxy.local", false},
+		{"socks5://user:pw@127.0.0.1:1080", "socks5://user:pw@127.0.0.1:1080", false},
+		{"ftp://proxy.local", "", true},
+		{"http://", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseProxyURL(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseProxyURL(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestProxyFuncEnvironment(t *testing.T) {
+	setProxy(t, "", "", "")
+	t.Setenv("HTTP_PROXY", "http://env-proxy:8080")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("NO_PROXY", "internal.example")
+
+	choose := proxyFunc()
+	for _, tt := range []struct{ url, want string }{
+		{"http://example.com/file", "http://env-proxy:8080"},
+		{"https://example.com/file", ""},
+		{"http://internal.example/file", ""},
+	} {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		got, err := choose(req)
+		if err != nil {
+			t.Fatalf("proxy for %s: %v", tt.url, err)
+		}
+		s := ""
+		if got != nil {
+			s = got.String()
+		}
+		if s != tt.want {
+			t.Errorf("proxy for %s = %q, want %q", tt.url, s, tt.want)
+		}
+	}
+
+	// --proxy overrides the environment, and --no-proxy turns it all off
+	proxyURL = "socks5://flag-proxy:1080"
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	if got, _ := proxyFunc()(req); got == nil || got.Host != "flag-proxy:1080" {
+		t.Errorf("proxy with --proxy = %v, want flag-proxy:1080", got)
+	}
+	noProxy = true
+	if proxyFunc() != nil {
+		t.Error("--no-proxy still chose a proxy")
+	}
+}
+
+func TestDownloadFileThroughHTTPProxy(t *testing.T) {
+	var target, auth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, auth = r.URL.String(), r.Header.Get("Proxy-Authorization")
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+	setProxy(t, proxy.URL, "me", "pw")
+
+	fileName := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile("http://origin.invalid/file", fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if target != "http://origin.invalid/file" {
+		t.Errorf("proxy was asked for %q", target)
+	}
+	if want := "Basic " + base64.StdEncoding.EncodeToString([]byte("me:pw")); auth != want {
+		t.Errorf("Proxy-Authorization = %q, want %q", auth, want)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "via proxy" {
+		t.Errorf("saved %q, want the proxied body", got)
+	}
+}
+
+func TestDownloadFileThroughSOCKS5(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socks"))
+	}))
+	defer origin.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	var user string
+	go serveSOCKS5(listener, origin.Listener.Addr().String(), &user)
+	setProxy(t, "socks5://"+listener.Addr().String(), "me", "pw")
+
+	fileName := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile("http://origin.invalid/file", fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if user != "me:pw" {
+		t.Errorf("SOCKS5 proxy got credentials %q, want me:pw", user)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "via socks" {
+		t.Errorf("saved %q, want the proxied body", got)
+	}
+}
+
+// serveSOCKS5 is a minimal SOCKS5 server requiring user name and password
+// authentication that connects every client to target, whatever it asks
+// for.
+func serveSOCKS5(listener net.Listener, target string, user *string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 512)
+
+			// Greeting: version, methods; choose user/password (2)
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			io.ReadFull(conn, buf[:buf[1]])
+			conn.Write([]byte{5, 2})
+
+			// Sub-negotiation: version, user, password
+			io.ReadFull(conn, buf[:2])
+			name := make([]byte, buf[1])
+			io.ReadFull(conn, name)
+			io.ReadFull(conn, buf[:1])
+			password := make([]byte, buf[0])
+			io.ReadFull(conn, password)
+			*user = string(name) + ":" + string(password)
+			conn.Write([]byte{1, 0})
+
+			// Request: version, CONNECT, reserved, address
+			io.ReadFull(conn, buf[:4])
+			switch buf[3] {
+			case 1:
+				io.ReadFull(conn, buf[:4+2])
+			case 3:
+				io.ReadFull(conn, buf[:1])
+				io.ReadFull(conn, buf[:int(buf[0])+2])
+			case 4:
+				io.ReadFull(conn, buf[:16+2])
+			}
+
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer upstream.Close()
+			host, portStr, _ := net.SplitHostPort(upstream.LocalAddr().String())
+			port, _ := strconv.Atoi(portStr)
+			conn.Write(append(append([]byte{5, 0, 0, 1}, net.ParseIP(host).To4()...), byte(port>>8), byte(port)))
+
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+	}
+}
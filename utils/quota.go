@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Download quota, set by -Q/--quota and --quota-abort. Once quota bytes
+// have been written no new transfer starts; with quotaAbort the ones in
+// progress are stopped as well.
+var (
+	quota      int64
+	quotaAbort bool
+)
+
+var (
+	quotaUsed atomic.Int64
+
+	quotaMu      sync.Mutex
+	quotaSkipped []string // URLs not fetched because the quota was used up
+	quotaStopped []string // transfers cut short by --quota-abort
+)
+
+// errQuotaExceeded is returned for transfers the quota does not allow.
+var errQuotaExceeded = errors.New("download quota exceeded")
+
+// quotaExceeded reports whether the quota has been used up.
+func quotaExceeded() bool {
+	return quota > 0 && quotaUsed.Load() >= quota
+}
+
+// checkQuota is called before a transfer starts. It refuses to start one
+// once the quota is used up, noting urlStr for the summary.
+func checkQuota(urlStr string) error {
+	if !quotaExceeded() {
+		return nil
+	}
+	skipForQuota(urlStr)
+	return errQuotaExceeded
+}
+
+// skipForQuota notes that urlStr is not fetched because of the quota.
+func skipForQuota(urlStr string) {
+	quotaMu.Lock()
+	quotaSkipped = append(quotaSkipped, urlStr)
+	quotaMu.Unlock()
+}
+
+// quotaWriter counts the bytes of a transfer against the quota. With
+// --quota-abort its writes fail once the quota is used up, ending the
+// transfer.
+type quotaWriter struct {
+	url  string
+	stop sync.Once // segments may all hit the quota
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	quotaUsed.Add(int64(len(p)))
+	if quotaAbort && quotaExceeded() {
+		w.stop.Do(func() {
+			quotaMu.Lock()
+			quotaStopped = append(quotaStopped, w.url)
+			quotaMu.Unlock()
+		})
+		return 0, errQuotaExceeded
+	}
+	return len(p), nil
+}
+
+// parseQuota reads a -Q size such as "500k", "20M" or "5G". "0" and "inf"
+// mean no quota.
+func parseQuota(value string) (int64, error) {
+	given := value
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "inf" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		case 't':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			value = value[:n-1]
+		}
+	}
+
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid quota %q", given)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// QuotaSummary reports how much of the -Q quota was used and, if it ran
+// out, which URLs were not fetched because of it. It prints nothing when no
+// quota was exceeded.
+func QuotaSummary() {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	if !quotaExceeded() && len(quotaSkipped) == 0 {
+		return
+	}
+
+	logf("\nDownload quota of %d bytes exceeded: %d bytes downloaded.\n", quota, quotaUsed.Load())
+	if len(quotaStopped) > 0 {
+		logf("Stopped %d transfer(s) in progress:\n", len(quotaStopped))
+		for _, u := range quotaStopped {
+			logf("  %s\n", u)
+		}
+	}
+	if len(quotaSkipped) > 0 {
+		logf("Skipped %d URL(s):\n", len(quotaSkipped))
+		for _, u := range quotaSkipped {
+			logf("  %s\n", u)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setQuota sets -Q and --quota-abort for a test, with nothing used yet.
+func setQuota(t *testing.T, size int64, abort bool) {
+	oldQuota, oldAbort := quota, quotaAbort
+	reset := func() {
+		quotaUsed.Store(0)
+		quotaSkipped, quotaStopped = nil, nil
+	}
+	quota, quotaAbort = size, abort
+	reset()
+	t.Cleanup(func() {
+		quota, quotaAbort = oldQuota, oldAbort
+		reset()
+	})
+}
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"1000", 1000},
+		{"500k", 500 << 10},
+		{"20M", 20 << 20},
+		{"5G", 5 << 30},
+		{"1.5g", 3 << 29},
+		{"inf", 0},
+		{"0", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseQuota(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("parseQuota(%q) = %d, %v; want %d", tt.input, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "G", "-1M", "lots"} {
+		if _, err := parseQuota(bad); err == nil {
+			t.Errorf("parseQuota(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestDownloadFilesQuotaSkipsLaterURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer server.Close()
+	setQuota(t, 1500, false)
+
+	urls := []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"}
+	var err error
+	// Writing to stdout fetches the list in order, one at a time
+	out := captureStdout(t, func() { err = DownloadFilesConcurrently(urls, "-", true, 0, "") })
+	if err != nil {
+		t.Fatalf("DownloadFilesConcurrently failed: %v", err)
+	}
+	if len(out) != 2000 {
+		t.Errorf("wrote %d bytes, want the first two files", len(out))
+	}
+	if len(quotaSkipped) != 1 || quotaSkipped[0] != server.URL+"/c" {
+		t.Errorf("skipped %q, want only /c", quotaSkipped)
+	}
+}
+
+func TestDownloadFilesQuotaConcurrent(t *testing.T) {
+	for _, chunked := range []bool{false, true} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strings.Repeat("x", 500)))
+			if chunked {
+				// No Content-Length, so the size is not known up front
+				w.(http.Flusher).Flush()
+			}
+			w.Write([]byte(strings.Repeat("x", 500)))
+		}))
+		setQuota(t, 1500, false)
+
+		var urls []string
+		for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+			urls = append(urls, server.URL+"/"+name)
+		}
+		if err := DownloadFilesConcurrently(urls, "out", true, 0, t.TempDir()); err != nil {
+			t.Fatalf("DownloadFilesConcurrently failed: %v", err)
+		}
+		if used := quotaUsed.Load(); used != 2000 {
+			t.Errorf("chunked %v: downloaded %d bytes, want the first two files", chunked, used)
+		}
+		if want := urls[2:]; strings.Join(quotaSkipped, " ") != strings.Join(want, " ") {
+			t.Errorf("chunked %v: skipped %q, want %q", chunked, quotaSkipped, want)
+		}
+		server.Close()
+	}
+}
+
+func TestDownloadFileQuotaAbort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100000)))
+	}))
+	defer server.Close()
+	setQuota(t, 1000, true)
+
+	err := DownloadFile(server.URL+"/big", filepath.Join(t.TempDir(), "big"), true, 0)
+	if !errors.Is(err, errQuotaExceeded) {
+		t.Fatalf("DownloadFile = %v, want the quota exceeded", err)
+	}
+	if len(quotaStopped) != 1 || quotaStopped[0] != server.URL+"/big" {
+		t.Errorf("stopped %q, want /big", quotaStopped)
+	}
+
+	if err := DownloadFile(server.URL+"/next", filepath.Join(t.TempDir(), "next"), true, 0); !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("DownloadFile after the quota = %v, want it refused", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,6 +16,7 @@ type RateLimitReader struct {
 	lastRead   time.Time
 	readBytes  int64
 	bucketSize int64
+	mu         sync.Mutex // guards the bucket when readers are shared
 }
 
 // parseRateLimit converts rate which is a string (like "400k" or "2M") to bytes per second
@@ -53,38 +55,79 @@ func NewRateLimitReader(reader io.Reader, rateLimit int64) *RateLimitReader {
 	}
 }
 
-// Read is our custom io.Reader with rate limiting 
+// Read is our custom io.Reader with rate limiting
 func (r *RateLimitReader) Read(p []byte) (int, error) {
 	if r.rateLimit <= 0 {
 		return r.reader.Read(p)
 	}
+	return r.readFrom(r.reader, p)
+}
+
+// Share returns a reader over another source that draws from the same
+// bucket as r, so several readers together stay under one rate limit.
+func (r *RateLimitReader) Share(reader io.Reader) io.Reader {
+	return &sharedRateReader{limiter: r, reader: reader}
+}
+
+// readFrom reads from src into p without exceeding the available bucket.
+func (r *RateLimitReader) readFrom(src io.Reader, p []byte) (int, error) {
+	allowed := r.take(int64(len(p)))
+
+	// If we don't have enough in our bucket, sleep
+	if allowed <= 0 {
+		time.Sleep(time.Second / 10) // Sleep for a short duration
+		return 0, nil
+	}
+
+	n, err := src.Read(p[:allowed])
+
+	// Return whatever part of the reservation went unused
+	r.mu.Lock()
+	r.bucketSize += allowed - int64(n)
+	r.readBytes += int64(n)
+	r.mu.Unlock()
+
+	return n, err
+}
+
+// take reserves up to n bytes from the bucket after topping it up for the
+// time passed since the last read. It returns 0 when the bucket is empty.
+func (r *RateLimitReader) take(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
 	now := time.Now()
 	duration := now.Sub(r.lastRead).Seconds()
-	
+
 	// Calculate how many bytes we can read based on the time passed
 	r.bucketSize += int64(duration * float64(r.rateLimit))
 	if r.bucketSize > r.rateLimit {
 		r.bucketSize = r.rateLimit
 	}
+	r.lastRead = now
 
-	// If we don't have enough in our bucket, sleep
 	if r.bucketSize <= 0 {
-		time.Sleep(time.Second / 10) // Sleep for a short duration
-		return 0, nil
+		return 0
 	}
 
 	// Limit the read size to our available bucket size
-	if int64(len(p)) > r.bucketSize {
-		p = p[:r.bucketSize]
+	if n > r.bucketSize {
+		n = r.bucketSize
 	}
+	r.bucketSize -= n
+	return n
+}
 
-	n, err := r.reader.Read(p)
-	if n > 0 {
-		r.bucketSize -= int64(n)
-		r.readBytes += int64(n)
-		r.lastRead = now
-	}
+// sharedRateReader reads from its own source but is throttled by the
+// bucket of the RateLimitReader it was shared from.
+type sharedRateReader struct {
+	limiter *RateLimitReader
+	reader  io.Reader
+}
 
-	return n, err
-}
\ No newline at end of file
+func (s *sharedRateReader) Read(p []byte) (int, error) {
+	if s.limiter.rateLimit <= 0 {
+		return s.reader.Read(p)
+	}
+	return s.limiter.readFrom(s.reader, p)
+}
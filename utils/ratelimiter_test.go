@@ -109,3 +109,25 @@ func TestRateLimitReaderRead(t *testing.T) {
 		}
 	})
 }
+
+// TestRateLimitReaderShare tests that shared readers draw from one bucket
+func TestRateLimitReaderShare(t *testing.T) {
+	rateLimit := int64(10) // 10B/s
+	rlReader := NewRateLimitReader(bytes.NewReader([]byte("first reader")), rateLimit)
+	shared := rlReader.Share(bytes.NewReader([]byte("second reader")))
+
+	buf := make([]byte, 8)
+	n1, err := rlReader.Read(buf)
+	if err != nil {
+		t.Fatalf("Read returned an error: %v", err)
+	}
+	n2, err := shared.Read(buf)
+	if err != nil {
+		t.Fatalf("shared Read returned an error: %v", err)
+	}
+
+	// Only a little time has passed, so both reads together get about one bucket
+	if n1+n2 > 11 {
+		t.Errorf("shared reads returned %d bytes together; want <= %d", n1+n2, rateLimit)
+	}
+}
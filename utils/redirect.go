@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Redirect policy, set by --max-redirect and --refuse-downgrade.
+var (
+	maxRedirect     = 20
+	refuseDowngrade bool
+)
+
+// checkRedirect is the client's redirect policy. It prints each hop in the
+// style of the final "sending request" line and stops after --max-redirect
+// hops or, with --refuse-downgrade, at a redirect from HTTPS to HTTP.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if req.Response != nil {
+		logf("sending request, awaiting response... status %s\n", req.Response.Status)
+	}
+	logf("Location: %s [following]\n", req.URL)
+
+	if len(via) > maxRedirect {
+		return fmt.Errorf("%d redirections exceeded", maxRedirect)
+	}
+	if refuseDowngrade && via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme == "http" {
+		return fmt.Errorf("refusing to follow redirect from HTTPS to HTTP: %s", req.URL)
+	}
+	return nil
+}
+
+// finalURL returns the URL resp was actually served from, after any
+// redirects, or fallback if it is unknown.
+func finalURL(resp *http.Response, fallback string) string {
+	if resp.Request != nil && resp.Request.URL != nil {
+		return resp.Request.URL.String()
+	}
+	return fallback
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// setRedirectPolicy sets --max-redirect and --refuse-downgrade for a test.
+func setRedirectPolicy(t *testing.T, max int, refuse bool) {
+	oldMax, oldRefuse := maxRedirect, refuseDowngrade
+	maxRedirect, refuseDowngrade = max, refuse
+	t.Cleanup(func() { maxRedirect, refuseDowngrade = oldMax, oldRefuse })
+}
+
+// hopServer redirects /hop/n to /hop/n-1 until /hop/0, which serves the
+// file.
+func hopServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if n > 0 {
+			http.Redirect(w, r, "/hop/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("arrived"))
+	}))
+}
+
+func TestDownloadFileMaxRedirect(t *testing.T) {
+	server := hopServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	setRedirectPolicy(t, 3, false)
+	if err := DownloadFile(server.URL+"/hop/3", filepath.Join(dir, "three"), true, 0); err != nil {
+		t.Errorf("DownloadFile with 3 redirects failed: %v", err)
+	}
+	err := DownloadFile(server.URL+"/hop/4", filepath.Join(dir, "four"), true, 0)
+	if err == nil || !strings.Contains(err.Error(), "3 redirections exceeded") {
+		t.Errorf("DownloadFile with 4 redirects = %v, want 3 redirections exceeded", err)
+	}
+
+	setRedirectPolicy(t, 0, false)
+	if err := DownloadFile(server.URL+"/hop/1", filepath.Join(dir, "one"), true, 0); err == nil {
+		t.Error("DownloadFile followed a redirect with --max-redirect=0")
+	}
+}
+
+func TestDownloadFileRefuseDowngrade(t *testing.T) {
+	setTLS(t)
+	noCheckCertificate = true
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("insecure"))
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.RedirectHandler(plain.URL+"/file", http.StatusFound))
+	defer secure.Close()
+
+	dir := t.TempDir()
+	setRedirectPolicy(t, 20, true)
+	if err := DownloadFile(secure.URL, filepath.Join(dir, "refused"), true, 0); err == nil || !strings.Contains(err.Error(), "HTTPS to HTTP") {
+		t.Errorf("DownloadFile = %v, want the downgrade refused", err)
+	}
+
+	setRedirectPolicy(t, 20, false)
+	if err := DownloadFile(secure.URL, filepath.Join(dir, "allowed"), true, 0); err != nil {
+		t.Errorf("DownloadFile without --refuse-downgrade failed: %v", err)
+	}
+}
+
+func TestDownloadFileRedirectChainOutput(t *testing.T) {
+	server := hopServer()
+	defer server.Close()
+
+	r, w, _ := os.Pipe()
+	oldStderr := os.Stderr
+	os.Stderr = w
+	err := DownloadFile(server.URL+"/hop/2", filepath.Join(t.TempDir(), "file"), true, 0)
+	os.Stderr = oldStderr
+	w.Close()
+	if err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+
+	output := make([]byte, 64<<10)
+	n, _ := r.Read(output)
+	for _, want := range []string{
+		"status 302 Found\nLocation: " + server.URL + "/hop/1 [following]\n",
+		"status 302 Found\nLocation: " + server.URL + "/hop/0 [following]\n",
+		"status 200 OK\n",
+	} {
+		if !strings.Contains(string(output[:n]), want) {
+			t.Errorf("output lacks %q:\n%s", want, output[:n])
+		}
+	}
+}
+
+func TestMirrorResourceRedirectOffHost(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foreign"))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.RedirectHandler(other.URL+"/logo.png", http.StatusFound))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if _, err := downloadFile(server.URL+"/logo.png", dir, nil, nil); err == nil {
+		t.Error("a mirrored resource was saved from another host")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logo.png")); err == nil {
+		t.Error("logo.png was written")
+	}
+}
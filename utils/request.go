@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// defaultUserAgent is sent unless --user-agent or a --header says otherwise.
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3"
+
+// Request settings, set by --header, --user-agent, --method, --post-data,
+// --post-file and --body-data. They apply to every download request, from
+// a single URL, an -i list or --mirror.
+var (
+	extraHeaders  []string
+	userAgent     = defaultUserAgent
+	requestMethod string
+	requestBody   []byte // nil when no body was given
+)
+
+// newRequest builds the request used for every download: the configured
+// method, body and headers. Without --method it is a GET, or a POST when a
+// body was given.
+func newRequest(urlStr string) (*http.Request, error) {
+	method := requestMethod
+	if method == "" {
+		method = http.MethodGet
+		if requestBody != nil {
+			method = http.MethodPost
+		}
+	}
+	return buildRequest(method, urlStr, requestBody)
+}
+
+// newGetRequest builds a bodiless GET carrying the configured headers, for
+// fetches that are not downloads of the requested URLs, such as checksum
+// files.
+func newGetRequest(urlStr string) (*http.Request, error) {
+	return buildRequest(http.MethodGet, urlStr, nil)
+}
+
+func buildRequest(method, urlStr string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, urlStr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	if body != nil {
+		// A bytes.Reader lets the client replay the body on redirects
+		req, err = http.NewRequest(method, urlStr, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	takeURLUser(req.URL)
+	req.Header.Set("User-Agent", userAgent)
+
+	// The first --header of a name replaces any default; repeats add values
+	seen := make(map[string]bool)
+	for _, line := range extraHeaders {
+		key, value, _ := strings.Cut(line, ":")
+		key = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "Host":
+			req.Host = value
+		case seen[key]:
+			req.Header.Add(key, value)
+		default:
+			req.Header.Set(key, value)
+		}
+		seen[key] = true
+	}
+	return req, nil
+}
+
+// addHeader records a --header value. An empty value clears the headers
+// given so far.
+func addHeader(line string) error {
+	if strings.TrimSpace(line) == "" {
+		extraHeaders = nil
+		return nil
+	}
+	key, _, ok := strings.Cut(line, ":")
+	if !ok || strings.TrimSpace(key) == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("invalid header %q, want \"Name: value\"", line)
+	}
+	extraHeaders = append(extraHeaders, line)
+	return nil
+}
+
+// setBody records the request body given by --post-data, --post-file or
+// --body-data.
+func setBody(data []byte) {
+	if data == nil {
+		data = []byte{}
+	}
+	requestBody = data
+}
+
+// readBodyFile reads the body for --post-file; "-" reads standard input.
+func readBodyFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// setRequestSettings restores the request settings after a test
+func setRequestSettings(t *testing.T) {
+	oldHeaders, oldAgent, oldMethod, oldBody := extraHeaders, userAgent, requestMethod, requestBody
+	t.Cleanup(func() {
+		extraHeaders, userAgent, requestMethod, requestBody = oldHeaders, oldAgent, oldMethod, oldBody
+	})
+}
+
+func TestAddHeader(t *testing.T) {
+	setRequestSettings(t)
+	extraHeaders = nil
+
+	for _, line := range []string{"X-Token: abc", "Accept: text/plain", "Accept: application/json"} {
+		if err := addHeader(line); err != nil {
+			t.Fatalf("addHeader(%q) failed: %v", line, err)
+		}
+	}
+	for _, bad := range []string{"no colon", ": empty name", "Bad Name: x"} {
+		if err := addHeader(bad); err == nil {
+			t.Errorf("addHeader(%q) succeeded, want an error", bad)
+		}
+	}
+
+	req, err := newRequest("http://example.com/")
+	if err != nil {
+		t.Fatalf("newRequest failed: %v", err)
+	}
+	if got := req.Header.Get("X-Token"); got != "abc" {
+		t.Errorf("X-Token = %q, want abc", got)
+	}
+	if got := req.Header.Values("Accept"); len(got) != 2 {
+		t.Errorf("Accept = %q, want both values", got)
+	}
+
+	addHeader("")
+	if len(extraHeaders) != 0 {
+		t.Errorf("an empty --header left %q", extraHeaders)
+	}
+}
+
+func TestNewRequestOverrides(t *testing.T) {
+	setRequestSettings(t)
+	extraHeaders = []string{"User-Agent: custom/1.0", "Host: other.example"}
+
+	req, err := newRequest("http://example.com/")
+	if err != nil {
+		t.Fatalf("newRequest failed: %v", err)
+	}
+	if got := req.Header.Values("User-Agent"); len(got) != 1 || got[0] != "custom/1.0" {
+		t.Errorf("User-Agent = %q, want the --header value only", got)
+	}
+	if req.Host != "other.example" {
+		t.Errorf("Host = %q, want other.example", req.Host)
+	}
+	if req.Method != http.MethodGet {
+		t.Errorf("method = %s, want GET", req.Method)
+	}
+
+	setBody([]byte("a=1"))
+	if req, _ = newRequest("http://example.com/"); req.Method != http.MethodPost {
+		t.Errorf("method with a body = %s, want POST", req.Method)
+	}
+	requestMethod = "PUT"
+	if req, _ = newRequest("http://example.com/"); req.Method != "PUT" {
+		t.Errorf("method = %s, want PUT", req.Method)
+	}
+	if req, _ = newGetRequest("http://example.com/"); req.Method != http.MethodGet || req.ContentLength != 0 {
+		t.Errorf("newGetRequest made a %s with %d body bytes, want a bare GET", req.Method, req.ContentLength)
+	}
+}
+
+func TestDownloadFilePost(t *testing.T) {
+	setRequestSettings(t)
+
+	var method, body, agent, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, body, agent, contentType = r.Method, string(data), r.UserAgent(), r.Header.Get("Content-Type")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	userAgent = "test-agent"
+	setBody([]byte("name=value"))
+
+	fileName := filepath.Join(t.TempDir(), "result")
+	if err := DownloadFile(server.URL+"/form", fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if method != http.MethodPost || body != "name=value" {
+		t.Errorf("server got %s with body %q, want POST with name=value", method, body)
+	}
+	if agent != "test-agent" {
+		t.Errorf("User-Agent = %q, want test-agent", agent)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q, want a form", contentType)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "ok" {
+		t.Errorf("saved %q, want the response body", got)
+	}
+}
+
+func TestDownloadFilesConcurrentlyPostsOnce(t *testing.T) {
+	setRequestSettings(t)
+
+	var mu sync.Mutex
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mu.Lock()
+			posts++
+			mu.Unlock()
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	setBody([]byte("name=value"))
+	if err := DownloadFilesConcurrently([]string{server.URL + "/form"}, "out", true, 0, t.TempDir()); err != nil {
+		t.Fatalf("DownloadFilesConcurrently failed: %v", err)
+	}
+	if posts != 1 {
+		t.Errorf("the form was posted %d times, want once", posts)
+	}
+}
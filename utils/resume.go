@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// continueDownload is set by -c/--continue and makes DownloadFile pick up
+// where a previous, partial download of the same file left off.
+var continueDownload bool
+
+// resumeOffset returns how many bytes of fileName are already on disk in
+// its .part file. With -c, a partial file left under the final name, for
+// example by another tool, is continued too; inPlace reports that case.
+// Such a file is only moved to the .part file once the server has agreed
+// to send the rest (see adoptPartial), so a failed request leaves it be.
+func resumeOffset(fileName string) (offset int64, inPlace bool) {
+	if size := existingSize(partName(fileName)); size > 0 {
+		return size, false
+	}
+	if !continueDownload {
+		return 0, false
+	}
+	if size := existingSize(fileName); size > 0 {
+		return size, true
+	}
+	return 0, false
+}
+
+// adoptPartial moves a partial file found under fileName to its .part
+// file, where the rest of the body is appended.
+func adoptPartial(fileName string) error {
+	return os.Rename(fileName, partName(fileName))
+}
+
+// existingSize returns the size of the file at path, or 0 if it does not
+// exist or is not a regular file.
+func existingSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+// parseContentRange parses a "Content-Range: bytes start-end/total" header.
+// total is -1 when the server reports it as "*".
+func parseContentRange(header string) (start, end, total int64, err error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("unsupported content range %q", header)
+	}
+
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("malformed content range %q", header)
+	}
+	startPart, endPart, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("malformed content range %q", header)
+	}
+
+	if start, err = strconv.ParseInt(startPart, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed content range %q", header)
+	}
+	if end, err = strconv.ParseInt(endPart, 10, 64); err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("malformed content range %q", header)
+	}
+
+	total = -1
+	if totalPart != "*" {
+		if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil || total <= end {
+			return 0, 0, 0, fmt.Errorf("malformed content range %q", header)
+		}
+	}
+	return start, end, total, nil
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header string
+		start  int64
+		end    int64
+		total  int64
+		err    bool
+	}{
+		{"bytes 100-199/200", 100, 199, 200, false},
+		{"bytes 0-0/1", 0, 0, 1, false},
+		{"bytes 5-9/*", 5, 9, -1, false},
+		{"bytes 10-5/20", 0, 0, 0, true},
+		{"bytes 0-19/20x", 0, 0, 0, true},
+		{"items 0-1/2", 0, 0, 0, true},
+		{"", 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		start, end, total, err := parseContentRange(tt.header)
+		if (err != nil) != tt.err {
+			t.Errorf("parseContentRange(%q) error = %v, expected error: %v", tt.header, err, tt.err)
+			continue
+		}
+		if start != tt.start || end != tt.end || total != tt.total {
+			t.Errorf("parseContentRange(%q) = %d, %d, %d; want %d, %d, %d",
+				tt.header, start, end, total, tt.start, tt.end, tt.total)
+		}
+	}
+}
+
+func TestDownloadFileContinue(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+
+	ranged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ranged.Close()
+
+	unranged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer unranged.Close()
+
+	continueDownload = true
+	defer func() { continueDownload = false }()
+
+	tests := []struct {
+		name    string
+		url     string
+		partial []byte
+	}{
+		{"Resume partial file", ranged.URL, content[:400]},
+		{"Already complete", ranged.URL, content},
+		{"Server ignores range", unranged.URL, []byte("garbage that must be replaced")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "file.bin")
+			if err := os.WriteFile(fileName, tt.partial, 0644); err != nil {
+				t.Fatalf("failed to write partial file: %v", err)
+			}
+
+			if err := DownloadFile(tt.url, fileName, true, 0); err != nil {
+				t.Fatalf("DownloadFile failed: %v", err)
+			}
+
+			got, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatalf("failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("downloaded file has %d bytes, want %d matching bytes", len(got), len(content))
+			}
+		})
+	}
+}
+
+func TestDownloadFileContinueBadRangeThenDrop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" {
+			// The fallback request for the whole file fails
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Range", "bytes 0-99/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(make([]byte, 100))
+	}))
+	defer server.Close()
+
+	continueDownload = true
+	defer func() { continueDownload = false }()
+
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(partName(fileName), make([]byte, 300), 0644); err != nil {
+		t.Fatalf("failed to write part file: %v", err)
+	}
+	if err := DownloadFile(server.URL, fileName, true, 0); err == nil {
+		t.Fatal("expected an error when the restarted request fails")
+	}
+}
+
+func TestDownloadFileContinueUnreachable(t *testing.T) {
+	setRetryPolicy(t, 1)
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	continueDownload = true
+	defer func() { continueDownload = false }()
+
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(fileName, []byte("complete"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := DownloadFile(server.URL+"/file.bin", fileName, true, 0); err == nil {
+		t.Fatal("expected an error from an unreachable server")
+	}
+	if got, err := os.ReadFile(fileName); err != nil || string(got) != "complete" {
+		t.Errorf("file has %q (%v); want it left in place", got, err)
+	}
+	if _, err := os.Stat(partName(fileName)); !os.IsNotExist(err) {
+		t.Errorf("file was moved to its part file: %v", err)
+	}
+}
+
+func TestDownloadFileContinueOtherName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+		w.Write([]byte("a,b,c"))
+	}))
+	defer server.Close()
+
+	contentDisposition, continueDownload = true, true
+	defer func() { contentDisposition, continueDownload = false, false }()
+
+	// A file under the URL's name has nothing to do with the server's name
+	dir := t.TempDir()
+	guess := filepath.Join(dir, "download")
+	if err := os.WriteFile(guess, []byte("unrelated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownloadFile(server.URL+"/download", DirTarget(dir), true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if got, err := os.ReadFile(guess); err != nil || string(got) != "unrelated" {
+		t.Errorf("%s has %q (%v); want it left alone", guess, got, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "report.csv")); string(got) != "a,b,c" {
+		t.Errorf("report.csv has %q; want %q", got, "a,b,c")
+	}
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry policy, set by --tries, --waitretry and --retry-on-http-error.
+var (
+	maxTries         = 1
+	waitRetry        = 10 * time.Second
+	retryOnHTTPError []int
+)
+
+// statusError is returned when the server answers with an unexpected
+// status. retryAfter holds the server's Retry-After hint, if any.
+type statusError struct {
+	status     string
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("got status %s", e.status)
+}
+
+// newStatusError builds a statusError from resp.
+func newStatusError(resp *http.Response) *statusError {
+	return &statusError{
+		status:     resp.Status,
+		code:       resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// withRetry runs fn until it succeeds, fails with an error that is not
+// worth retrying, or the --tries budget is spent. Attempts are separated by
+// an exponential backoff with jitter, or by the server's Retry-After delay.
+func withRetry(label string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		if attempt >= maxTries {
+			if maxTries > 1 {
+				logf("giving up on %s after %d attempts\n", label, attempt)
+			}
+			return err
+		}
+
+		delay := retryDelay(attempt, err)
+		logf("%v; retrying %s in %.1fs (attempt %d of %d)\n", err, label, delay.Seconds(), attempt+1, maxTries)
+		time.Sleep(delay)
+	}
+}
+
+// maxRetryAfter is the longest a server's Retry-After may make us wait,
+// unless --waitretry allows longer.
+const maxRetryAfter = 5 * time.Minute
+
+// retryDelay picks the wait before the attempt following attempt. A
+// Retry-After from the server wins, up to maxRetryAfter or --waitretry;
+// otherwise the delay doubles with each attempt up to --waitretry, and half
+// of it is randomised so that parallel downloads do not retry in lockstep.
+func retryDelay(attempt int, err error) time.Duration {
+	var se *statusError
+	if errors.As(err, &se) && se.retryAfter > 0 {
+		return min(se.retryAfter, max(maxRetryAfter, waitRetry))
+	}
+
+	backoff := waitRetry
+	if attempt < 32 && time.Second<<(attempt-1) < waitRetry {
+		backoff = time.Second << (attempt - 1)
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// isRetryable reports whether err is a transient failure: a dropped or
+// timed-out connection, or one of the --retry-on-http-error statuses.
+// Local file errors, unknown hosts, untrusted certificates and an exhausted
+// quota are final.
+func isRetryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		for _, code := range retryOnHTTPError {
+			if code == se.code {
+				return true
+			}
+		}
+		return false
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+
+	if errors.Is(err, errQuotaExceeded) {
+		return false
+	}
+
+	// A certificate will not become trusted by asking again
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) || errors.Is(err, errPinMismatch) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter reads a Retry-After header given either as a number of
+// seconds or as an HTTP date. It returns 0 when the header is absent or
+// unusable.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil && when.After(now) {
+		return when.Sub(now)
+	}
+	return 0
+}
+
+// parseStatusList converts a comma-separated list like "503,429" into
+// status codes.
+func parseStatusList(list string) ([]int, error) {
+	var codes []int
+	for _, part := range removeEmptyStrings(strings.Split(list, ",")) {
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid HTTP status %q", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// parseSeconds converts a wget-style time value into a duration. Plain
+// numbers are seconds ("10", "1.5"); Go durations like "500ms" or "2m" are
+// accepted as well.
+func parseSeconds(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("negative time %q", value)
+		}
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return d, nil
+}
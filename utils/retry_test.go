@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setRetryPolicy swaps in a fast retry policy for the duration of a test
+func setRetryPolicy(t *testing.T, tries int, statuses ...int) {
+	oldTries, oldWait, oldStatuses := maxTries, waitRetry, retryOnHTTPError
+	maxTries, waitRetry, retryOnHTTPError = tries, 10*time.Millisecond, statuses
+	t.Cleanup(func() {
+		maxTries, waitRetry, retryOnHTTPError = oldTries, oldWait, oldStatuses
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.expected {
+			t.Errorf("parseRetryAfter(%q) = %v; want %v", tt.header, got, tt.expected)
+		}
+	}
+}
+
+func TestParseStatusList(t *testing.T) {
+	codes, err := parseStatusList("503, 429,")
+	if err != nil {
+		t.Fatalf("parseStatusList returned an error: %v", err)
+	}
+	if len(codes) != 2 || codes[0] != 503 || codes[1] != 429 {
+		t.Errorf("parseStatusList = %v; want [503 429]", codes)
+	}
+
+	if _, err := parseStatusList("503,abc"); err == nil {
+		t.Error("expected an error for a non-numeric status")
+	}
+	if _, err := parseStatusList("42"); err == nil {
+		t.Error("expected an error for an out-of-range status")
+	}
+}
+
+func TestParseSeconds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{"10", 10 * time.Second, false},
+		{"1.5", 1500 * time.Millisecond, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"2m", 2 * time.Minute, false},
+		{"-1", 0, true},
+		{"later", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSeconds(tt.input)
+		if (err != nil) != tt.err {
+			t.Errorf("parseSeconds(%q) returned error: %v, expected error: %v", tt.input, err, tt.err)
+		}
+		if got != tt.expected {
+			t.Errorf("parseSeconds(%q) = %v; want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	setRetryPolicy(t, 3, 503)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Listed status", &statusError{status: "503 Service Unavailable", code: 503}, true},
+		{"Unlisted status", &statusError{status: "404 Not Found", code: 404}, false},
+		{"Unexpected EOF", fmt.Errorf("error: %w", io.ErrUnexpectedEOF), true},
+		{"Local file error", &os.PathError{Op: "open", Path: "x", Err: os.ErrPermission}, false},
+		{"Other error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.expected {
+				t.Errorf("isRetryable(%v) = %v; want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	setRetryPolicy(t, 5)
+	waitRetry = 4 * time.Second
+
+	for attempt := 1; attempt <= 6; attempt++ {
+		backoff := min(time.Second<<(attempt-1), waitRetry)
+		delay := retryDelay(attempt, errors.New("boom"))
+		if delay < backoff/2 || delay > backoff {
+			t.Errorf("retryDelay(%d) = %v; want between %v and %v", attempt, delay, backoff/2, backoff)
+		}
+	}
+
+	err := &statusError{code: 503, retryAfter: 7 * time.Second}
+	if delay := retryDelay(1, err); delay != 7*time.Second {
+		t.Errorf("retryDelay with Retry-After = %v; want 7s", delay)
+	}
+
+	// A server cannot make us wait for days
+	err = &statusError{code: 503, retryAfter: 999999 * time.Second}
+	if delay := retryDelay(1, err); delay != maxRetryAfter {
+		t.Errorf("retryDelay with a huge Retry-After = %v; want %v", delay, maxRetryAfter)
+	}
+	waitRetry = time.Hour
+	if delay := retryDelay(1, err); delay != time.Hour {
+		t.Errorf("retryDelay with a huge Retry-After and --waitretry=1h = %v; want 1h", delay)
+	}
+}
+
+func TestDownloadFileRetriesStatus(t *testing.T) {
+	setRetryPolicy(t, 3, 503)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("finally"))
+	}))
+	defer server.Close()
+
+	fileName := filepath.Join(t.TempDir(), "file.txt")
+	if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("server saw %d requests, want 3", n)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "finally" {
+		t.Errorf("downloaded %q, want %q", got, "finally")
+	}
+}
+
+func TestDownloadFileRetryResumes(t *testing.T) {
+	setRetryPolicy(t, 2)
+
+	content := []byte(strings.Repeat("0123456789", 100))
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) == 1 {
+			// Promise the whole file, send half of it and drop the connection
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:500])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fileName := filepath.Join(t.TempDir(), "file.bin")
+	if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+
+	if len(ranges) != 2 || ranges[1] != "bytes=500-" {
+		t.Errorf("server saw ranges %q, want a retry resuming at byte 500", ranges)
+	}
+	got, _ := os.ReadFile(fileName)
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded file has %d bytes, want %d matching bytes", len(got), len(content))
+	}
+}
+
+func TestMirrorDownloadFileRetryResumes(t *testing.T) {
+	setRetryPolicy(t, 2)
+
+	content := []byte(strings.Repeat("0123456789", 100))
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file.bin" {
+			http.NotFound(w, r)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) == 1 {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:500])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if _, err := downloadFile(server.URL+"/file.bin", dir, nil, nil); err != nil {
+		t.Fatalf("downloadFile failed: %v", err)
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=500-" {
+		t.Errorf("server saw ranges %q, want a retry resuming at byte 500", ranges)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "file.bin")); !bytes.Equal(got, content) {
+		t.Errorf("saved file has %d bytes, want %d matching bytes", len(got), len(content))
+	}
+}
+
+func TestDownloadFileGivesUp(t *testing.T) {
+	setRetryPolicy(t, 2)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	err := DownloadFile(server.URL, filepath.Join(t.TempDir(), "file.txt"), true, 0)
+	if err == nil {
+		t.Fatal("expected an error for a 404 response")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("server saw %d requests; a 404 should not be retried", n)
+	}
+}
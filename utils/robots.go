@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// robotsEnabled is turned off by -e robots=off. The crawler then ignores
+// robots.txt, <meta name="robots"> and rel="nofollow".
+var robotsEnabled = true
+
+var (
+	robotsMu    sync.Mutex
+	robotsCache = make(map[string]*robotsEntry) // by origin
+)
+
+// robotsEntry is the robots.txt of one origin, fetched on first use.
+type robotsEntry struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+// robotsRules are the parts of a robots.txt that apply to us.
+type robotsRules struct {
+	rules []robotsRule
+	delay time.Duration // Crawl-delay
+}
+
+// robotsRule is an Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsAllowed reports whether robots.txt lets the crawler fetch urlStr.
+func robotsAllowed(urlStr string) bool {
+	if !robotsEnabled {
+		return true
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Path == "/robots.txt" {
+		return true
+	}
+	return robotsFor(u).allows(u)
+}
+
+// crawlDelay returns the Crawl-delay robots.txt asks for on u's host.
+func crawlDelay(u *url.URL) time.Duration {
+	if !robotsEnabled {
+		return 0
+	}
+	return robotsFor(u).delay
+}
+
+// robotsFor returns the rules for u's origin, fetching its robots.txt the
+// first time.
+func robotsFor(u *url.URL) *robotsRules {
+	o := origin(u)
+	robotsMu.Lock()
+	entry, ok := robotsCache[o]
+	if !ok {
+		entry = &robotsEntry{}
+		robotsCache[o] = entry
+	}
+	robotsMu.Unlock()
+
+	entry.once.Do(func() {
+		entry.rules = fetchRobots(u.Scheme + "://" + u.Host + "/robots.txt")
+	})
+	return entry.rules
+}
+
+// fetchRobots downloads and parses a robots.txt. A missing or unreadable
+// file allows everything.
+func fetchRobots(robotsURL string) *robotsRules {
+	req, err := newGetRequest(robotsURL)
+	if err != nil {
+		return &robotsRules{}
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		logf("Warning: could not fetch %s: %v\n", robotsURL, err)
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}
+	}
+
+	// Like the big crawlers, read no more than 500 KiB
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 500<<10))
+	if err != nil {
+		return &robotsRules{}
+	}
+	logf("Loaded %s\n", robotsURL)
+	return parseRobots(string(body), userAgent)
+}
+
+// parseRobots reads the groups of a robots.txt that apply to agent: those
+// naming one of its robotsNames, or else those for "*".
+func parseRobots(data, agent string) *robotsRules {
+	names := robotsNames(agent)
+	var mine, anyone robotsRules
+	matched := false           // a group names us, even if it has no rules
+	var current []*robotsRules // the groups the lines being read belong to
+	inRules := false
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				// A user-agent line after rules starts a new group
+				current, inRules = nil, false
+			}
+			switch name := strings.ToLower(value); {
+			case name == "*":
+				current = append(current, &anyone)
+			case names[name]:
+				current = append(current, &mine)
+				matched = true
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// "Disallow:" with no path allows everything
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value, re: robotsPattern(value)}
+			for _, group := range current {
+				group.rules = append(group.rules, rule)
+			}
+		case "crawl-delay":
+			inRules = true
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				for _, group := range current {
+					group.delay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	if matched {
+		return &robotsRules{rules: mine.rules, delay: mine.delay}
+	}
+	return &robotsRules{rules: anyone.rules, delay: anyone.delay}
+}
+
+// robotsNames returns the lower-case names a robots.txt group must give
+// to apply to agent: wget, and the product token agent starts with, as in
+// "MyBot/1.0". The default agent poses as a browser, so its token is not
+// ours to claim.
+func robotsNames(agent string) map[string]bool {
+	names := map[string]bool{"wget": true}
+	if fields := strings.Fields(agent); len(fields) > 0 && agent != defaultUserAgent {
+		product, _, _ := strings.Cut(fields[0], "/")
+		names[strings.ToLower(product)] = true
+	}
+	return names
+}
+
+// robotsPattern compiles a robots.txt path, where "*" matches any run of
+// characters and a trailing "$" anchors the end.
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allows applies the rules to u: the longest matching pattern decides, and
+// Allow wins a tie.
+func (r *robotsRules) allows(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(target) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || n == longest && rule.allow {
+			allowed, longest = rule.allow, n
+		}
+	}
+	return allowed
+}
+
+// metaRobots reads the <meta name="robots"> directives of a page: noindex
+// asks for it not to be kept, nofollow for its links not to be followed.
+func metaRobots(htmlContent string) (noindex, nofollow bool) {
+	if !robotsEnabled {
+		return false, false
+	}
+	z := html.NewTokenizer(strings.NewReader(htmlContent))
+	for tt := z.Next(); tt != html.ErrorToken; tt = z.Next() {
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tok := z.Token()
+		if tok.Data == "body" {
+			break
+		}
+		if tok.Data != "meta" || !strings.EqualFold(attrValue(tok, "name"), "robots") {
+			continue
+		}
+		for _, directive := range strings.Split(strings.ToLower(attrValue(tok, "content")), ",") {
+			switch strings.TrimSpace(directive) {
+			case "noindex":
+				noindex = true
+			case "nofollow":
+				nofollow = true
+			case "none":
+				noindex, nofollow = true, true
+			}
+		}
+	}
+	return noindex, nofollow
+}
+
+// runCommand carries out a wgetrc-style -e command. Only robots=on|off is
+// supported.
+func runCommand(command string) error {
+	name, value, ok := strings.Cut(command, "=")
+	if !ok {
+		return fmt.Errorf("invalid command %q (want name=value)", command)
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch name {
+	case "robots":
+		switch value {
+		case "on", "yes", "1":
+			robotsEnabled = true
+		case "off", "no", "0":
+			robotsEnabled = false
+		default:
+			return fmt.Errorf("invalid value %q for robots (use on or off)", value)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
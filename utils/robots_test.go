@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setRobots sets whether robots rules are obeyed for a test.
+func setRobots(t *testing.T, enabled bool) {
+	saved := robotsEnabled
+	robotsEnabled = enabled
+	t.Cleanup(func() { robotsEnabled = saved })
+}
+
+func TestParseRobots(t *testing.T) {
+	const robots = `# comments are ignored
+User-agent: Googlebot
+Disallow: /
+
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Disallow:
+Crawl-delay: 1.5
+`
+	rules := parseRobots(robots, defaultUserAgent)
+	if rules.delay != 1500*time.Millisecond {
+		t.Errorf("delay = %v, want 1.5s", rules.delay)
+	}
+
+	tests := map[string]bool{
+		"/":                       true,
+		"/private/":               false,
+		"/private/x.html":         false,
+		"/private/public":         true,
+		"/private/public/a.html":  true,
+		"/docs/manual.pdf":        false,
+		"/docs/manual.pdf?page=2": true,
+		"/search?q=go":            false,
+		"/search":                 true,
+	}
+	for path, want := range tests {
+		u, _ := url.Parse("http://example.com" + path)
+		if got := rules.allows(u); got != want {
+			t.Errorf("allows(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestParseRobotsOwnGroup(t *testing.T) {
+	const robots = `User-agent: *
+Disallow: /
+
+User-agent: Wget
+User-agent: OtherBot
+Disallow: /tmp/
+Allow: /tmp/keep
+Disallow: /tmp/keep
+`
+	rules := parseRobots(robots, "Wget/1.21")
+	for path, want := range map[string]bool{"/": true, "/tmp/x": false, "/tmp/keep": true} {
+		u, _ := url.Parse("http://example.com" + path)
+		if got := rules.allows(u); got != want {
+			t.Errorf("allows(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestParseRobotsGroupChoice(t *testing.T) {
+	root, _ := url.Parse("http://example.com/")
+	tests := []struct {
+		name, robots, agent string
+		allowed             bool
+	}{
+		{"empty own group", "User-agent: wget\nDisallow:\n\nUser-agent: *\nDisallow: /\n", defaultUserAgent, true},
+		{"browser names are not ours", "User-agent: Safari\nUser-agent: Chrome\nUser-agent: Mozilla\nDisallow: /\n", defaultUserAgent, true},
+		{"own product token", "User-agent: mybot\nDisallow: /\n", "MyBot/2.1 (+https://example.org)", false},
+		{"no partial token", "User-agent: bot\nDisallow: /\n", "MyBot/2.1", true},
+	}
+	for _, tt := range tests {
+		if got := parseRobots(tt.robots, tt.agent).allows(root); got != tt.allowed {
+			t.Errorf("%s: allows(/) = %v, want %v", tt.name, got, tt.allowed)
+		}
+	}
+}
+
+func TestMetaRobots(t *testing.T) {
+	setRobots(t, true)
+	tests := []struct {
+		doc               string
+		noindex, nofollow bool
+	}{
+		{`<meta name="robots" content="noindex, nofollow">`, true, true},
+		{`<meta name="ROBOTS" content="NOFOLLOW">`, false, true},
+		{`<meta name="robots" content="none">`, true, true},
+		{`<meta name="description" content="noindex">`, false, false},
+		{`<body><p>noindex</p></body>`, false, false},
+	}
+	for _, tt := range tests {
+		noindex, nofollow := metaRobots(tt.doc)
+		if noindex != tt.noindex || nofollow != tt.nofollow {
+			t.Errorf("metaRobots(%s) = %v, %v, want %v, %v", tt.doc, noindex, nofollow, tt.noindex, tt.nofollow)
+		}
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	setRobots(t, true)
+	if err := runCommand("robots = off"); err != nil || robotsEnabled {
+		t.Errorf("robots=off: err %v, enabled %v", err, robotsEnabled)
+	}
+	if err := runCommand("robots=on"); err != nil || !robotsEnabled {
+		t.Errorf("robots=on: err %v, enabled %v", err, robotsEnabled)
+	}
+	for _, bad := range []string{"robots", "robots=maybe", "tries=3"} {
+		if err := runCommand(bad); err == nil {
+			t.Errorf("runCommand(%q) succeeded", bad)
+		}
+	}
+}
+
+// robotsSite serves a small site that asks crawlers to keep out of parts
+// of it, and returns it with the paths it served.
+func robotsSite(t *testing.T) (*httptest.Server, func(string) bool) {
+	var mu sync.Mutex
+	served := make(map[string]bool)
+	pages := map[string]string{
+		"/":              `<a href="/open.html">o</a> <a href="/secret/a.html">s</a> <a href="/ad.html" rel="sponsored nofollow">ad</a> <a href="/hidden.html">h</a> <img src="/secret/pic.png">`,
+		"/open.html":     `open`,
+		"/secret/a.html": `secret`,
+		"/ad.html":       `ad`,
+		"/hidden.html":   `<meta name="robots" content="noindex,nofollow"><a href="/deeper.html">d</a>`,
+		"/deeper.html":   `deeper`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		served[r.URL.Path] = true
+		mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /secret/\n"))
+			return
+		}
+		if r.URL.Path == "/secret/pic.png" {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+			return
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, func(path string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return served[path]
+	}
+}
+
+func TestMirrorWebsiteRobots(t *testing.T) {
+	setRobots(t, true)
+	server, served := robotsSite(t)
+	dir := inTempDir(t)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+
+	for path, want := range map[string]bool{
+		"/open.html":      true,
+		"/hidden.html":    true,
+		"/secret/a.html":  false,
+		"/secret/pic.png": false,
+		"/ad.html":        false,
+		"/deeper.html":    false,
+	} {
+		if served(path) != want {
+			t.Errorf("%s fetched = %v, want %v", path, served(path), want)
+		}
+	}
+
+	u, _ := url.Parse(server.URL)
+	if _, err := os.Stat(filepath.Join(dir, u.Host, "hidden.html")); !os.IsNotExist(err) {
+		t.Errorf("noindex page was saved: %v", err)
+	}
+}
+
+func TestMirrorWebsiteRobotsOff(t *testing.T) {
+	setRobots(t, false)
+	server, served := robotsSite(t)
+	inTempDir(t)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+	for _, path := range []string{"/secret/a.html", "/secret/pic.png", "/ad.html", "/deeper.html"} {
+		if !served(path) {
+			t.Errorf("%s was not fetched with robots=off", path)
+		}
+	}
+	if served("/robots.txt") {
+		t.Error("robots.txt was fetched with robots=off")
+	}
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Politeness settings, set by --wait, --random-wait and --max-per-host.
+// A maxPerHost of 0 leaves the number of parallel requests to a host
+// unlimited.
+var (
+	wait       time.Duration
+	randomWait bool
+	maxPerHost int
+)
+
+var (
+	hostsMu sync.Mutex
+	hosts   = make(map[string]*hostQueue)
+)
+
+// hostQueue paces the crawler's requests to one host. It is shared by all
+// the goroutines of a mirror.
+type hostQueue struct {
+	slots chan struct{} // one per request in flight; nil for no limit
+
+	mu   sync.Mutex
+	next time.Time // the earliest the next request may start
+}
+
+// acquireHost waits until the crawler may send a request to urlStr's host:
+// until fewer than --max-per-host requests to it are in flight, and the
+// --wait or robots.txt Crawl-delay since the last one has passed. The
+// returned function must be called once the response has been read.
+func acquireHost(urlStr string) (release func()) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return func() {}
+	}
+	q := hostQueueFor(u.Host)
+	if q.slots != nil {
+		q.slots <- struct{}{}
+	}
+
+	if delay := hostDelay(u); delay > 0 {
+		q.mu.Lock()
+		now := time.Now()
+		start := q.next
+		if start.Before(now) {
+			start = now
+		}
+		q.next = start.Add(delay)
+		q.mu.Unlock()
+		time.Sleep(time.Until(start))
+	}
+
+	return func() {
+		if q.slots != nil {
+			<-q.slots
+		}
+	}
+}
+
+// hostQueueFor returns the queue of host, creating it on first use.
+func hostQueueFor(host string) *hostQueue {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	q, ok := hosts[host]
+	if !ok {
+		q = &hostQueue{}
+		if maxPerHost > 0 {
+			q.slots = make(chan struct{}, maxPerHost)
+		}
+		hosts[host] = q
+	}
+	return q
+}
+
+// hostDelay returns how long to leave between requests to u's host: --wait,
+// varied between half and one and a half times with --random-wait, but
+// never less than the host's Crawl-delay.
+func hostDelay(u *url.URL) time.Duration {
+	delay := wait
+	if randomWait && delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay)+1))
+	}
+	if d := crawlDelay(u); d > delay {
+		delay = d
+	}
+	return delay
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setPoliteness sets --wait, --random-wait and --max-per-host for a test,
+// with fresh host queues.
+func setPoliteness(t *testing.T, w time.Duration, random bool, perHost int) {
+	savedWait, savedRandom, savedMax := wait, randomWait, maxPerHost
+	wait, randomWait, maxPerHost = w, random, perHost
+	resetHosts := func() {
+		hostsMu.Lock()
+		hosts = make(map[string]*hostQueue)
+		hostsMu.Unlock()
+	}
+	resetHosts()
+	t.Cleanup(func() {
+		wait, randomWait, maxPerHost = savedWait, savedRandom, savedMax
+		resetHosts()
+	})
+}
+
+func TestAcquireHostWait(t *testing.T) {
+	setRobots(t, false)
+	setPoliteness(t, 50*time.Millisecond, false, 0)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		acquireHost("http://wait.example/page")()
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("three requests took %v, want at least two waits of 50ms", elapsed)
+	}
+
+	// Other hosts have queues of their own
+	start = time.Now()
+	acquireHost("http://other.example/")()
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("first request to another host waited %v", elapsed)
+	}
+}
+
+func TestHostDelayRandomWait(t *testing.T) {
+	setRobots(t, false)
+	setPoliteness(t, time.Second, true, 0)
+	u, _ := url.Parse("http://example.com/")
+	for i := 0; i < 50; i++ {
+		if d := hostDelay(u); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("random wait %v outside 0.5s-1.5s", d)
+		}
+	}
+}
+
+func TestHostDelayCrawlDelay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nCrawl-delay: 2\n"))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/")
+
+	setRobots(t, true)
+	setPoliteness(t, time.Second, false, 0)
+	if d := hostDelay(u); d != 2*time.Second {
+		t.Errorf("delay = %v, want the 2s Crawl-delay", d)
+	}
+	wait = 3 * time.Second
+	if d := hostDelay(u); d != 3*time.Second {
+		t.Errorf("delay = %v, want the longer 3s --wait", d)
+	}
+	robotsEnabled = false
+	wait = 0
+	if d := hostDelay(u); d != 0 {
+		t.Errorf("delay with robots=off = %v, want 0", d)
+	}
+}
+
+func TestMirrorWebsiteMaxPerHost(t *testing.T) {
+	setRobots(t, false)
+	setPoliteness(t, 0, false, 2)
+
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<img src="/1.png"><img src="/2.png"><img src="/3.png"><img src="/4.png"><img src="/5.png"><img src="/6.png">`))
+			return
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	inTempDir(t)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if most != 2 {
+		t.Errorf("at most %d requests were in flight, want 2", most)
+	}
+}
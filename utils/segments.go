@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// segments is set by --segments. Values above 1 split a download into that
+// many byte ranges fetched in parallel when the server supports it.
+var segments int
+
+// canSegment reports whether resp, the answer to a plain GET, allows the
+// file to be fetched as several byte ranges. Other methods are not split,
+// since each segment would repeat the request.
+func canSegment(resp *http.Response) bool {
+	return resp.Request.Method == http.MethodGet &&
+		resp.StatusCode == http.StatusOK &&
+		resp.ContentLength > 0 &&
+		resp.Header.Get("Accept-Ranges") == "bytes"
+}
+
+// downloadSegments fetches size bytes of urlStr as n concurrent range
+// requests and writes each one into its place in out. first is the body of
+// the already-open full GET and supplies the first segment. When limiter is
+// non-nil every segment draws from its bucket, so the rate limit applies to
+// the download as a whole.
+func downloadSegments(urlStr string, out *os.File, size int64, n int, first io.Reader, limiter *RateLimitReader, progress io.Writer) error {
+	if int64(n) > size {
+		n = int(size)
+	}
+
+	// Preallocate so every segment can write at its own offset
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errorChan := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		start := size * int64(i) / int64(n)
+		end := size*int64(i+1)/int64(n) - 1
+
+		wg.Add(1)
+		go func(index int, start, end int64) {
+			defer wg.Done()
+
+			var body io.Reader
+			if index == 0 {
+				body = first
+			} else {
+				resp, err := requestRange(urlStr, start, end)
+				if err != nil {
+					errorChan <- fmt.Errorf("segment %d: %v", index, err)
+					return
+				}
+				defer resp.Body.Close()
+
+				if err := checkSegment(resp, start); err != nil {
+					errorChan <- fmt.Errorf("segment %d: %v", index, err)
+					return
+				}
+				body = resp.Body
+			}
+
+			if limiter != nil {
+				body = limiter.Share(body)
+			}
+
+			w := io.MultiWriter(io.NewOffsetWriter(out, start), progress)
+			if _, err := io.CopyN(w, body, end-start+1); err != nil {
+				errorChan <- fmt.Errorf("segment %d: %v", index, err)
+			}
+		}(i, start, end)
+	}
+
+	wg.Wait()
+	close(errorChan)
+
+	// Report the first failure; the others usually share its cause
+	for err := range errorChan {
+		return err
+	}
+	return nil
+}
+
+// checkSegment makes sure a range response starts where it was asked to.
+func checkSegment(resp *http.Response, start int64) error {
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	got, _, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return err
+	}
+	if got != start {
+		return fmt.Errorf("server returned range starting at %d, want %d", got, start)
+	}
+	return nil
+}
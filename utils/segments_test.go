@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadFileSegments(t *testing.T) {
+	content := []byte(strings.Repeat("abcdefghijklmnopqrstuvwxyz", 400))
+
+	var rangeRequests int32
+	ranged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&rangeRequests, 1)
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ranged.Close()
+
+	unranged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer unranged.Close()
+
+	segments = 4
+	defer func() { segments = 1 }()
+
+	tests := []struct {
+		name          string
+		url           string
+		rateLimit     int64
+		rangeRequests int32
+	}{
+		{"Segmented download", ranged.URL, 0, 3},
+		{"Segmented download with rate limit", ranged.URL, 64 * 1024, 3},
+		{"Server without ranges", unranged.URL, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&rangeRequests, 0)
+			fileName := filepath.Join(t.TempDir(), "file.bin")
+
+			if err := DownloadFile(tt.url, fileName, false, tt.rateLimit); err != nil {
+				t.Fatalf("DownloadFile failed: %v", err)
+			}
+
+			got, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatalf("failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("downloaded file has %d bytes, want %d matching bytes", len(got), len(content))
+			}
+			if n := atomic.LoadInt32(&rangeRequests); n != tt.rangeRequests {
+				t.Errorf("server saw %d range requests, want %d", n, tt.rangeRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// spider is set by --spider: URLs are checked, not downloaded.
+var spider bool
+
+var (
+	brokenMu    sync.Mutex
+	brokenLinks []brokenLink
+)
+
+// brokenLink is a URL that failed its --spider check.
+type brokenLink struct {
+	url string
+	err error
+}
+
+// checkURL verifies that urlStr can be fetched, without saving it. It asks
+// with HEAD and, if the server refuses that, with a GET for the first byte.
+// The outcome is printed, and failures are remembered for SpiderSummary.
+func checkURL(urlStr string) error {
+	_, err := checkURLType(urlStr)
+	return err
+}
+
+// checkURLType is checkURL, also returning the Content-Type the server
+// reported, so that the crawler can tell which links lead to pages.
+func checkURLType(urlStr string) (string, error) {
+	var contentType string
+	err := withRetry(urlStr, func() error {
+		resp, err := spiderRequest(http.MethodHead, urlStr)
+		if err == nil && resp.StatusCode >= 400 {
+			// Some servers reject HEAD, or sign URLs for GET only
+			resp, err = spiderRequest(http.MethodGet, urlStr)
+		}
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			return newStatusError(resp)
+		}
+
+		size := resp.ContentLength
+		if resp.StatusCode == http.StatusPartialContent {
+			if _, _, total, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil {
+				size = total
+			}
+		}
+		sizeText := "unknown"
+		if size >= 0 {
+			sizeText = fmt.Sprintf("%d [~%.2fMB]", size, float64(size)/1000/1000)
+		}
+		contentType = resp.Header.Get("Content-Type")
+		typeText := contentType
+		if typeText == "" {
+			typeText = "unknown"
+		}
+		logf("checked %s: status %s, size %s, type %s\n", urlStr, resp.Status, sizeText, typeText)
+		return nil
+	})
+	if err != nil {
+		recordBroken(urlStr, err)
+	}
+	return contentType, err
+}
+
+// recordBroken reports urlStr as broken and remembers it for the summary.
+func recordBroken(urlStr string, err error) {
+	logf("broken %s: %v\n", urlStr, err)
+	brokenMu.Lock()
+	brokenLinks = append(brokenLinks, brokenLink{url: urlStr, err: err})
+	brokenMu.Unlock()
+}
+
+// spiderRequest sends a bodiless request for urlStr. A GET only asks for
+// the first byte.
+func spiderRequest(method, urlStr string) (*http.Response, error) {
+	req, err := buildRequest(method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	return httpClient().Do(req)
+}
+
+// SpiderSummary prints the broken links found by --spider and returns an
+// error if there were any. Without --spider it does nothing.
+func SpiderSummary() error {
+	if !spider {
+		return nil
+	}
+
+	brokenMu.Lock()
+	defer brokenMu.Unlock()
+	if len(brokenLinks) == 0 {
+		logf("\nFound no broken links.\n")
+		return nil
+	}
+
+	logf("\nFound %d broken link(s):\n", len(brokenLinks))
+	for _, link := range brokenLinks {
+		logf("  %s: %v\n", link.url, link.err)
+	}
+	return fmt.Errorf("%d broken link(s)", len(brokenLinks))
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setSpider turns on --spider for a test, starting with no broken links.
+func setSpider(t *testing.T) {
+	old := spider
+	spider = true
+	brokenLinks = nil
+	t.Cleanup(func() {
+		spider = old
+		brokenLinks = nil
+	})
+}
+
+func brokenURLs() []string {
+	brokenMu.Lock()
+	defer brokenMu.Unlock()
+	var urls []string
+	for _, link := range brokenLinks {
+		urls = append(urls, link.url)
+	}
+	return urls
+}
+
+func TestCheckURL(t *testing.T) {
+	var gets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			if r.Method != http.MethodHead {
+				t.Errorf("/ok was fetched with %s", r.Method)
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("hello"))
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			gets = append(gets, r.Header.Get("Range"))
+			http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader("0123456789"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	setSpider(t)
+	if err := checkURL(server.URL + "/ok"); err != nil {
+		t.Errorf("checkURL(/ok) failed: %v", err)
+	}
+	if err := checkURL(server.URL + "/no-head"); err != nil {
+		t.Errorf("checkURL(/no-head) failed: %v", err)
+	}
+	if len(gets) != 1 || gets[0] != "bytes=0-0" {
+		t.Errorf("GET fallback sent Range %q, want one bytes=0-0", gets)
+	}
+	if err := checkURL(server.URL + "/missing"); err == nil {
+		t.Error("checkURL(/missing) succeeded")
+	}
+
+	if got := brokenURLs(); len(got) != 1 || got[0] != server.URL+"/missing" {
+		t.Errorf("broken links = %q, want only /missing", got)
+	}
+	if err := SpiderSummary(); err == nil {
+		t.Error("SpiderSummary returned nil with a broken link")
+	}
+}
+
+func TestDownloadFileSpiderWritesNothing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	setSpider(t)
+	target := filepath.Join(t.TempDir(), "file")
+	if err := DownloadFile(server.URL+"/file", target, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("--spider wrote %s", target)
+	}
+	if err := SpiderSummary(); err != nil {
+		t.Errorf("SpiderSummary = %v, want nil", err)
+	}
+}
+
+func TestMirrorWebsiteSpider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="stylesheet" href="/style.css"></head>` +
+				`<body><img src="/logo.png"><img src="/gone.png"></body></html>`))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`body { background: url("/missing-bg.png"); }`))
+		case "/logo.png":
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := inTempDir(t)
+
+	setSpider(t)
+	if err := MirrorWebsite(server.URL+"/", nil, nil, false); err != nil {
+		t.Fatalf("MirrorWebsite failed: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("--spider created %d entries in the working directory", len(entries))
+	}
+	got := strings.Join(brokenURLs(), " ")
+	for _, want := range []string{"/gone.png", "/missing-bg.png"} {
+		if !strings.Contains(got, server.URL+want) {
+			t.Errorf("broken links %q do not include %s", got, want)
+		}
+	}
+	if strings.Contains(got, "/logo.png") {
+		t.Errorf("broken links %q include /logo.png", got)
+	}
+}
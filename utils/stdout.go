@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// isStdout reports whether fileName, as given to -O, asks for the body to
+// be written to standard output.
+func isStdout(fileName string) bool {
+	return fileName == "-"
+}
+
+// toStdout streams the body to standard output instead of a file. There is
+// no file to name, resume, clobber or timestamp, and the body is not split
+// into segments.
+func (t *transfer) toStdout() error {
+	st := &stdoutTransfer{transfer: t}
+
+	want, err := expectedChecksum(t.url, GetFileName(t.url))
+	if err != nil {
+		return err
+	}
+	if want != nil {
+		st.want, st.hasher = want, want.newHash()
+	}
+
+	if err := withRetry(t.url, st.attempt); err != nil {
+		return err
+	}
+	logf("Downloaded [%s]\nfinished at %s\n", t.url, time.Now().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// stdoutTransfer is the state of a download to standard output, kept across
+// retries. What has been written cannot be taken back, so a retry continues
+// after the last byte written, skipping that much of the body if the server
+// ignores the range request.
+type stdoutTransfer struct {
+	*transfer
+	written int64
+	want    *checksum
+	hasher  hash.Hash
+
+	headersWritten bool // --save-headers output, which goes out only once
+}
+
+// attempt makes a single try at streaming the rest of the body to stdout.
+func (t *stdoutTransfer) attempt() error {
+	offset := t.written
+
+	resp, err := t.request(offset)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	defer func() { resp.Body.Close() }()
+
+	if offset > 0 && resp.StatusCode == http.StatusPartialContent {
+		if start, _, _, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil || start != offset {
+			// Fall back to the whole body and skip what was already written
+			if err := t.reissue(&resp, 0); err != nil {
+				return fmt.Errorf("error: %w", err)
+			}
+		}
+	}
+	if resp.StatusCode != http.StatusOK && !(offset > 0 && resp.StatusCode == http.StatusPartialContent) {
+		return fmt.Errorf("error: %w", newStatusError(resp))
+	}
+	logf("sending request, awaiting response... status %s\n", resp.Status)
+
+	contentLength := resp.ContentLength
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+	} else if offset > 0 && contentLength >= 0 {
+		contentLength += offset
+	}
+	logf("content size: %d [~%.2fMB]\n", contentLength, float64(contentLength)/1000/1000)
+	logCompression(resp.Body)
+	if offset > 0 {
+		logf("resuming from byte %d\n", offset)
+	}
+	logf("saving file to: standard output\n")
+	if saveHeaders && !t.headersWritten {
+		if _, err := os.Stdout.Write(headerBlock(resp)); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		t.headersWritten = true
+	}
+
+	// Bytes count against -Q as they are written
+	progress := io.MultiWriter(newProgress(resp.Body, contentLength, offset, t.background), &quotaWriter{url: t.url})
+
+	writers := []io.Writer{stdoutWriter{t}, progress}
+	if t.hasher != nil {
+		writers = append(writers, t.hasher)
+	}
+
+	var reader io.Reader = resp.Body
+	if t.rateLimit > 0 {
+		logf("Rate limit set to: %.2f KB/s\n", float64(t.rateLimit)/1024)
+		reader, _ = limitBody(resp.Body, t.rateLimit)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), reader); err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	if !t.background && contentLength < 0 {
+		logf("\n\n")
+	}
+	if contentLength >= 0 && t.written != contentLength {
+		return fmt.Errorf("error: got %d of %d bytes: %w", t.written, contentLength, io.ErrUnexpectedEOF)
+	}
+
+	if t.want != nil {
+		// The data is already out, so a mismatch can only be reported
+		if err := t.want.verify(t.hasher); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		logf("checksum OK (%s)\n", t.want.algo)
+	}
+	return nil
+}
+
+// request issues the GET for the body from byte offset on.
+func (t *stdoutTransfer) request(offset int64) (*http.Response, error) {
+	req, err := newRequest(t.url)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return httpClient().Do(req)
+}
+
+// stdoutWriter writes to os.Stdout, counting the bytes that made it out.
+// os.Stdout is looked up on every write so that -B can redirect it.
+type stdoutWriter struct {
+	t *stdoutTransfer
+}
+
+func (w stdoutWriter) Write(p []byte) (int, error) {
+	n, err := os.Stdout.Write(p)
+	w.t.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout runs fn with os.Stdout redirected and returns what it wrote.
+func captureStdout(t *testing.T, fn func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestDownloadFileToStdout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("piped content"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(oldWd)
+
+	got := captureStdout(t, func() {
+		// With the progress bar on, so that its output is checked as well
+		if err := DownloadFile(server.URL+"/file.txt", "-", false, 0); err != nil {
+			t.Errorf("DownloadFile failed: %v", err)
+		}
+	})
+	if string(got) != "piped content" {
+		t.Errorf("stdout has %q; want only the body", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files were created in the working directory: %v", entries)
+	}
+}
+
+func TestDownloadFileToStdoutRetry(t *testing.T) {
+	setRetryPolicy(t, 2)
+
+	content := []byte(strings.Repeat("0123456789", 100))
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) == 1 {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:500])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	got := captureStdout(t, func() {
+		if err := DownloadFile(server.URL, "-", true, 0); err != nil {
+			t.Errorf("DownloadFile failed: %v", err)
+		}
+	})
+	if len(ranges) != 2 || ranges[1] != "bytes=500-" {
+		t.Errorf("server saw ranges %q, want a retry continuing at byte 500", ranges)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("stdout has %d bytes, want %d matching bytes", len(got), len(content))
+	}
+}
+
+func TestDownloadFileToStdoutRetryFallbackFails(t *testing.T) {
+	setRetryPolicy(t, 2)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Content-Length", "1000")
+			w.Write(make([]byte, 500))
+			w.(http.Flusher).Flush()
+		case 2:
+			// A range other than the one asked for, so the retry falls back
+			// to the whole body, which then fails
+			w.Header().Set("Content-Range", "bytes 0-99/1000")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(make([]byte, 100))
+			return
+		}
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer server.Close()
+
+	captureStdout(t, func() {
+		if err := DownloadFile(server.URL, "-", true, 0); err == nil {
+			t.Error("expected an error when the fallback request fails")
+		}
+	})
+}
+
+func TestDownloadFilesConcurrentlyToStdout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Answer the first URL last, to show the order is kept anyway
+		if r.URL.Path == "/1" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte("body" + r.URL.Path + "\n"))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/1", server.URL + "/2", server.URL + "/3"}
+	got := captureStdout(t, func() {
+		if err := DownloadFilesConcurrently(urls, "-", true, 0, t.TempDir()); err != nil {
+			t.Errorf("DownloadFilesConcurrently failed: %v", err)
+		}
+	})
+	if want := "body/1\nbody/2\nbody/3\n"; string(got) != want {
+		t.Errorf("stdout has %q, want %q", got, want)
+	}
+}
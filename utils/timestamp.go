@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// timestamping is set by -N/--timestamping. Files are then only fetched
+// when the server's copy is newer than the local one.
+var timestamping bool
+
+// addConditions makes req conditional on the file at localPath being out
+// of date: If-Modified-Since carries its mtime and If-None-Match the ETag
+// remembered from the download that produced it.
+func addConditions(req *http.Request, localPath string) {
+	info, err := os.Stat(localPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	if etag := readETag(localPath); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+}
+
+// remoteIsNewer decides, for a server that ignored the conditional request
+// and sent the whole file anyway, whether it should replace the local copy.
+// The file is kept when the server's Last-Modified is not after the local
+// mtime and the sizes agree.
+func remoteIsNewer(resp *http.Response, localPath string) bool {
+	info, err := os.Stat(localPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return true
+	}
+
+	modified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil || modified.After(info.ModTime()) {
+		return true
+	}
+	return resp.ContentLength >= 0 && resp.ContentLength != info.Size()
+}
+
+// saveTimestamp gives the freshly downloaded file at localPath the server's
+// Last-Modified time and remembers its ETag for the next -N run.
+func saveTimestamp(localPath string, header http.Header) {
+	if modified, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		os.Chtimes(localPath, time.Now(), modified)
+	}
+
+	if etag := header.Get("ETag"); etag != "" {
+		os.WriteFile(etagPath(localPath), []byte(etag+"\n"), 0644)
+	} else {
+		os.Remove(etagPath(localPath))
+	}
+}
+
+// readETag returns the ETag stored next to localPath, if any.
+func readETag(localPath string) string {
+	data, err := os.ReadFile(etagPath(localPath))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// etagPath is the hidden file in which the ETag of localPath is kept.
+func etagPath(localPath string) string {
+	dir, base := filepath.Split(localPath)
+	return filepath.Join(dir, "."+base+".etag")
+}
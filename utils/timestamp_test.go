@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadFileTimestamping(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	content := []byte("nightly build")
+
+	var statuses []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		http.ServeContent(rec, r, "build.bin", modified, bytes.NewReader(content))
+		statuses = append(statuses, rec.status)
+	}))
+	defer server.Close()
+
+	timestamping = true
+	defer func() { timestamping = false }()
+
+	fileName := filepath.Join(t.TempDir(), "build.bin")
+	for i := 0; i < 2; i++ {
+		if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+			t.Fatalf("DownloadFile failed: %v", err)
+		}
+	}
+
+	if len(statuses) != 2 || statuses[0] != http.StatusOK || statuses[1] != http.StatusNotModified {
+		t.Errorf("server answered %v; want [200 304]", statuses)
+	}
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatalf("failed to stat downloaded file: %v", err)
+	}
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("file mtime is %v; want Last-Modified %v", info.ModTime(), modified)
+	}
+}
+
+func TestDownloadFileTimestampingIgnoredConditionals(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		w.Write([]byte("server copy"))
+	}))
+	defer server.Close()
+
+	timestamping = true
+	defer func() { timestamping = false }()
+
+	tests := []struct {
+		name     string
+		local    string
+		mtime    time.Time
+		expected string
+	}{
+		{"Same size and not older", "local copy!", modified, "local copy!"},
+		{"Local copy is older", "local copy!", modified.Add(-time.Hour), "server copy"},
+		{"Sizes differ", "local", modified, "server copy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "file.txt")
+			os.WriteFile(fileName, []byte(tt.local), 0644)
+			os.Chtimes(fileName, tt.mtime, tt.mtime)
+
+			if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+				t.Fatalf("DownloadFile failed: %v", err)
+			}
+			if got, _ := os.ReadFile(fileName); string(got) != tt.expected {
+				t.Errorf("file has %q; want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDownloadFileTimestampingETag(t *testing.T) {
+	var ifNoneMatch []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("versioned"))
+	}))
+	defer server.Close()
+
+	timestamping = true
+	defer func() { timestamping = false }()
+
+	fileName := filepath.Join(t.TempDir(), "file.txt")
+	for i := 0; i < 2; i++ {
+		if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+			t.Fatalf("DownloadFile failed: %v", err)
+		}
+	}
+
+	if len(ifNoneMatch) != 2 || ifNoneMatch[0] != "" || ifNoneMatch[1] != `"v1"` {
+		t.Errorf("server saw If-None-Match %q; want the stored ETag on the second request", ifNoneMatch)
+	}
+}
+
+// statusRecorder remembers the status written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TLS settings, set by --ca-certificate, --ca-directory, --certificate,
+// --private-key, --no-check-certificate, --secure-protocol and
+// --pinnedpubkey.
+var (
+	caCertificate      string
+	caDirectory        string
+	clientCertificate  string
+	privateKey         string
+	noCheckCertificate bool
+	minTLSVersion      uint16
+	pinnedKeys         [][]byte // SHA-256 digests of acceptable server public keys
+)
+
+// errPinMismatch is returned when the server's key is not one of the
+// --pinnedpubkey keys.
+var errPinMismatch = errors.New("server public key does not match --pinnedpubkey")
+
+// newTLSConfig builds the TLS configuration for every HTTPS connection.
+func newTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: noCheckCertificate,
+		MinVersion:         minTLSVersion,
+	}
+
+	if caCertificate != "" || caDirectory != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if caCertificate != "" {
+			if err := addCertificates(pool, caCertificate); err != nil {
+				return nil, err
+			}
+		}
+		if caDirectory != "" {
+			entries, err := os.ReadDir(caDirectory)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					// Not every file in a certificate directory is a certificate
+					addCertificates(pool, filepath.Join(caDirectory, entry.Name()))
+				}
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if clientCertificate != "" {
+		key := privateKey
+		if key == "" {
+			// The key may be in the same file as the certificate
+			key = clientCertificate
+		}
+		cert, err := tls.LoadX509KeyPair(clientCertificate, key)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(pinnedKeys) > 0 {
+		config.VerifyConnection = verifyPinnedKey
+	}
+	return config, nil
+}
+
+// addCertificates adds the PEM certificates in the file at path to pool.
+func addCertificates(pool *x509.CertPool, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return nil
+}
+
+// verifyPinnedKey accepts the connection only if the server's certificate
+// carries one of the pinned public keys. It runs even with
+// --no-check-certificate.
+func verifyPinnedKey(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errPinMismatch
+	}
+	sum := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	for _, pin := range pinnedKeys {
+		if string(pin) == string(sum[:]) {
+			return nil
+		}
+	}
+	return errPinMismatch
+}
+
+// parsePinnedKeys parses a --pinnedpubkey list in curl's format:
+// "sha256//<base64>" entries separated by semicolons.
+func parsePinnedKeys(value string) ([][]byte, error) {
+	var pins [][]byte
+	for _, entry := range removeEmptyStrings(strings.Split(value, ";")) {
+		encoded, ok := strings.CutPrefix(entry, "sha256//")
+		if !ok {
+			return nil, fmt.Errorf("invalid pin %q, want sha256//<base64>", entry)
+		}
+		pin, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid pin %q: not a base64 SHA-256 digest", entry)
+		}
+		pins = append(pins, pin)
+	}
+	if len(pins) == 0 {
+		return nil, fmt.Errorf("no pins in %q", value)
+	}
+	return pins, nil
+}
+
+// parseSecureProtocol maps a --secure-protocol name to the lowest TLS
+// version to accept. "auto" leaves the choice to the TLS library.
+func parseSecureProtocol(value string) (uint16, error) {
+	switch strings.NewReplacer("_", ".", "v", "").Replace(strings.ToLower(value)) {
+	case "auto":
+		return 0, nil
+	case "tls1", "tls1.0":
+		return tls.VersionTLS10, nil
+	case "tls1.1":
+		return tls.VersionTLS11, nil
+	case "tls1.2":
+		return tls.VersionTLS12, nil
+	case "tls1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported protocol %q (use auto, TLSv1_2 or TLSv1_3)", value)
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setTLS restores the TLS settings after a test and gives it a fresh
+// client.
+func setTLS(t *testing.T) {
+	oldCA, oldDir, oldCert, oldKey := caCertificate, caDirectory, clientCertificate, privateKey
+	oldInsecure, oldMin, oldPins := noCheckCertificate, minTLSVersion, pinnedKeys
+	resetHTTPClient()
+	t.Cleanup(func() {
+		caCertificate, caDirectory, clientCertificate, privateKey = oldCA, oldDir, oldCert, oldKey
+		noCheckCertificate, minTLSVersion, pinnedKeys = oldInsecure, oldMin, oldPins
+		resetHTTPClient()
+	})
+}
+
+// writePEM writes a PEM block to a new file in dir and returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestParsePinnedKeys(t *testing.T) {
+	sum := sha256.Sum256([]byte("key"))
+	pin := "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+
+	if pins, err := parsePinnedKeys(pin + ";" + pin); err != nil || len(pins) != 2 {
+		t.Errorf("parsePinnedKeys = %d pins, %v; want 2", len(pins), err)
+	}
+	for _, bad := range []string{"", "md5//abc", "sha256//not-base64!", "sha256//" + base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := parsePinnedKeys(bad); err == nil {
+			t.Errorf("parsePinnedKeys(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestParseSecureProtocol(t *testing.T) {
+	tests := map[string]uint16{"auto": 0, "TLSv1_2": tls.VersionTLS12, "tlsv1_3": tls.VersionTLS13, "TLSv1": tls.VersionTLS10}
+	for value, want := range tests {
+		if got, err := parseSecureProtocol(value); err != nil || got != want {
+			t.Errorf("parseSecureProtocol(%q) = %x, %v; want %x", value, got, err, want)
+		}
+	}
+	if _, err := parseSecureProtocol("SSLv3"); err == nil {
+		t.Error("parseSecureProtocol(SSLv3) succeeded, want an error")
+	}
+}
+
+func TestDownloadFileTLSVerification(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	sum := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	goodPin, _ := parsePinnedKeys("sha256//" + base64.StdEncoding.EncodeToString(sum[:]))
+	otherSum := sha256.Sum256([]byte("other"))
+	badPin, _ := parsePinnedKeys("sha256//" + base64.StdEncoding.EncodeToString(otherSum[:]))
+
+	tests := []struct {
+		name    string
+		setup   func()
+		wantErr error
+	}{
+		{"untrusted", func() {}, &tls.CertificateVerificationError{}},
+		{"ca-certificate", func() { caCertificate = caFile }, nil},
+		{"ca-directory", func() { caDirectory = dir }, nil},
+		{"no-check-certificate", func() { noCheckCertificate = true }, nil},
+		{"matching pin", func() { caCertificate, pinnedKeys = caFile, goodPin }, nil},
+		{"wrong pin", func() { caCertificate, pinnedKeys = caFile, badPin }, errPinMismatch},
+		{"wrong pin without verification", func() { noCheckCertificate, pinnedKeys = true, badPin }, errPinMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTLS(t)
+			tt.setup()
+
+			err := DownloadFile(server.URL+"/file", filepath.Join(t.TempDir(), "file"), true, 0)
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("DownloadFile failed: %v", err)
+				}
+			case *tls.CertificateVerificationError:
+				if !errors.As(err, &want) {
+					t.Errorf("DownloadFile error = %v, want a certificate error", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("DownloadFile error = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadFileMinimumTLSVersion(t *testing.T) {
+	setTLS(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("old"))
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	noCheckCertificate, minTLSVersion = true, tls.VersionTLS13
+	if err := DownloadFile(server.URL, filepath.Join(t.TempDir(), "file"), true, 0); err == nil {
+		t.Error("DownloadFile accepted TLS 1.2 with --secure-protocol TLSv1_3")
+	}
+}
+
+func TestDownloadFileClientCertificate(t *testing.T) {
+	setTLS(t)
+
+	// A self-signed client certificate
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	noCheckCertificate = true
+	if err := DownloadFile(server.URL, filepath.Join(dir, "anonymous"), true, 0); err == nil {
+		t.Error("DownloadFile succeeded without the required client certificate")
+	}
+
+	clientCertificate = writePEM(t, dir, "client.pem", "CERTIFICATE", der)
+	privateKey = writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+	resetHTTPClient()
+
+	fileName := filepath.Join(dir, "file")
+	if err := DownloadFile(server.URL, fileName, true, 0); err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(fileName); string(got) != "hello client" {
+		t.Errorf("saved %q, want the server to have seen the client certificate", got)
+	}
+}